@@ -0,0 +1,82 @@
+package main
+
+import (
+    "math"
+    "time"
+)
+
+// bucket summarizes the samples sent within one -aggregate window.
+type bucket struct {
+    Start time.Time
+    Min   float64 // ms, over replies
+    Avg   float64
+    Max   float64
+    N     int // samples in the window
+    Lost  int // lost samples in the window
+}
+
+// aggregate buckets samples into windows of the given width, aligned to the
+// wall clock. Windows without any sample are left out. A window in which
+// every probe was lost gets the deadTimeout value for min, avg and max, so
+// it shows up the same way a loss does in the raw plot.
+func aggregate(times []float64, stamps []time.Time, deadTimeout float64, width time.Duration) []bucket {
+    var buckets []bucket
+    var sum float64
+    for i, v := range times {
+        start := stamps[i].Truncate(width)
+        if len(buckets) == 0 || !buckets[len(buckets)-1].Start.Equal(start) {
+            buckets = append(buckets, bucket{Start: start})
+            sum = 0
+        }
+        b := &buckets[len(buckets)-1]
+        b.N++
+        if v == deadTimeout {
+            b.Lost++
+        } else {
+            replies := b.N - b.Lost
+            if replies == 1 || v < b.Min {
+                b.Min = v
+            }
+            if replies == 1 || v > b.Max {
+                b.Max = v
+            }
+            sum += v
+            b.Avg = sum / float64(replies)
+        }
+        if b.Lost == b.N {
+            b.Min, b.Avg, b.Max = deadTimeout, deadTimeout, deadTimeout
+        }
+    }
+    return buckets
+}
+
+// bucketSeries returns the plot series for buckets: max and min, which draw
+// the band, followed by the average line drawn on top of them.
+func bucketSeries(buckets []bucket) [][]float64 {
+    maxs := make([]float64, len(buckets))
+    mins := make([]float64, len(buckets))
+    avgs := make([]float64, len(buckets))
+    for i, b := range buckets {
+        maxs[i] = b.Max
+        mins[i] = b.Min
+        avgs[i] = b.Avg
+    }
+    return [][]float64{maxs, mins, avgs}
+}
+
+// lossSeries returns the loss percentage of every bucket as the series at
+// index main of n series, the others NaN so they draw nothing but keep
+// their length.
+func lossSeries(buckets []bucket, main, n int) [][]float64 {
+    series := make([][]float64, n)
+    for k := range series {
+        series[k] = make([]float64, len(buckets))
+        for i, b := range buckets {
+            series[k][i] = math.NaN()
+            if k == main {
+                series[k][i] = float64(b.Lost) / float64(b.N) * 100
+            }
+        }
+    }
+    return series
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "time"
+)
+
+// alert describes a metric of a target that crossed its threshold.
+type alert struct {
+    Host      string    `json:"host"`
+    Metric    string    `json:"metric"`
+    Value     float64   `json:"value"`
+    Threshold float64   `json:"threshold"`
+    Time      time.Time `json:"time"`
+}
+
+func (a alert) String() string {
+    switch a.Metric {
+    case "avg_change_pct":
+        return fmt.Sprintf("avg +%.0f%% vs previous window (limit %.0f%%)", a.Value, a.Threshold)
+    case "avg_rtt_ms":
+        return fmt.Sprintf("avg %.1f ms over last window (limit %.1f ms)", a.Value, a.Threshold)
+    case "loss_pct":
+        return fmt.Sprintf("loss %.1f%% over last window (limit %.1f%%)", a.Value, a.Threshold)
+    case "jitter_ms":
+        return fmt.Sprintf("jitter %.2f ms over last window (limit %.2f ms)", a.Value, a.Threshold)
+    }
+    return fmt.Sprintf("%s %.2f exceeds %.2f", a.Metric, a.Value, a.Threshold)
+}
+
+// alertHandler is called once when an alert starts firing.
+type alertHandler func(a alert)
+
+// alertState remembers which metrics of a target are currently firing, so
+// handlers only see transitions instead of one call per refresh. A muted
+// target keeps showing its alerts but does not notify the handlers.
+type alertState struct {
+    active map[string]alert
+    muted  bool
+}
+
+// update records whether the alert's metric is firing and notifies the
+// handlers if it just started.
+func (s *alertState) update(a alert, firing bool, handlers []alertHandler) {
+    if s.active == nil {
+        s.active = make(map[string]alert)
+    }
+    _, wasFiring := s.active[a.Metric]
+    if !firing {
+        delete(s.active, a.Metric)
+        return
+    }
+    s.active[a.Metric] = a
+    if !wasFiring && !s.muted {
+        for _, handle := range handlers {
+            handle(a)
+        }
+    }
+}
+
+// text renders the firing alerts as highlighted stats lines.
+func (s *alertState) text() string {
+    if len(s.active) == 0 {
+        return ""
+    }
+    metrics := make([]string, 0, len(s.active))
+    for metric := range s.active {
+        metrics = append(metrics, metric)
+    }
+    sort.Strings(metrics)
+
+    label := "ALERT"
+    if s.muted {
+        label = "ALERT (muted)"
+    }
+    var b strings.Builder
+    for _, metric := range metrics {
+        fmt.Fprintf(&b, "[%s: %s](fg:red)\n", label, s.active[metric])
+    }
+    return b.String()
+}
+
+// bellAlertHandler rings the terminal bell for every new alert.
+func bellAlertHandler(out io.Writer) alertHandler {
+    return func(a alert) {
+        io.WriteString(out, "\a")
+    }
+}
+
+// desktopAlertHandler shows a desktop notification for every new alert.
+// The notification tool runs in the background so a slow desktop does not
+// hold up the caller.
+func desktopAlertHandler() alertHandler {
+    return func(a alert) {
+        go func() {
+            if err := desktopNotify("pingGraphGo alert: "+a.Host, a.String()); err != nil {
+                diag.Printf("Error showing desktop notification: %v\n", err)
+            }
+        }()
+    }
+}
+
+// windowAverages returns the average valid RTT over the last window samples
+// and over the window right before it. ok is false until both windows are
+// complete and contain at least one reply.
+func windowAverages(times []float64, deadTimeout float64, window int) (current float64, previous float64, ok bool) {
+    if window <= 0 || len(times) < 2*window {
+        return 0, 0, false
+    }
+    end := len(times)
+    current, okCurrent := validAverage(times[end-window:end], deadTimeout)
+    previous, okPrevious := validAverage(times[end-2*window:end-window], deadTimeout)
+    return current, previous, okCurrent && okPrevious
+}
+
+func validAverage(times []float64, deadTimeout float64) (float64, bool) {
+    sum := 0.0
+    count := 0
+    for _, t := range times {
+        if t != deadTimeout {
+            sum += t
+            count++
+        }
+    }
+    if count == 0 {
+        return 0, false
+    }
+    return sum / float64(count), true
+}
+
+// checkWindowChange raises the avg_change_pct alert when the average of the
+// current window is more than limit percent above the previous window.
+// t.mutex must be held.
+func checkWindowChange(t *target, deadTimeout float64, window int, limit float64, handlers []alertHandler) {
+    if limit <= 0 {
+        return
+    }
+    current, previous, ok := windowAverages(t.times, deadTimeout, window)
+    if !ok || previous <= 0 {
+        return
+    }
+    change := (current - previous) / previous * 100
+    t.alerts.update(alert{
+        Host:      t.name(),
+        Metric:    "avg_change_pct",
+        Value:     change,
+        Threshold: limit,
+        Time:      time.Now(),
+    }, change > limit, handlers)
+}
+
+// checkThresholds raises the avg_rtt_ms and loss_pct alerts when the last
+// window of samples is slower than rttLimit milliseconds on average or lost
+// more than lossLimit percent of the probes. A limit of 0 disables the
+// check. t.mutex must be held.
+func checkThresholds(t *target, deadTimeout float64, window int, rttLimit float64, lossLimit float64, handlers []alertHandler) {
+    if window <= 0 || len(t.times) < window {
+        return
+    }
+    last := t.times[len(t.times)-window:]
+    now := time.Now()
+
+    if rttLimit > 0 {
+        if avg, ok := validAverage(last, deadTimeout); ok {
+            t.alerts.update(alert{
+                Host:      t.name(),
+                Metric:    "avg_rtt_ms",
+                Value:     avg,
+                Threshold: rttLimit,
+                Time:      now,
+            }, avg > rttLimit, handlers)
+        }
+    }
+
+    if lossLimit > 0 {
+        lost := 0
+        for _, v := range last {
+            if v == deadTimeout {
+                lost++
+            }
+        }
+        loss := float64(lost) / float64(len(last)) * 100
+        t.alerts.update(alert{
+            Host:      t.name(),
+            Metric:    "loss_pct",
+            Value:     loss,
+            Threshold: lossLimit,
+            Time:      now,
+        }, loss > lossLimit, handlers)
+    }
+}
+
+// checkJitter raises the jitter_ms alert when the jitter over the last
+// window of samples, computed as for the stats with -jitter-gaps, exceeds
+// limit milliseconds. A window without two replies to pair is skipped.
+// t.mutex must be held.
+func checkJitter(t *target, deadTimeout float64, window int, limit float64, gaps string, handlers []alertHandler) {
+    if limit <= 0 || window <= 0 || len(t.times) < window {
+        return
+    }
+    last := t.times[len(t.times)-window:]
+    replies := 0
+    for _, v := range last {
+        if v != deadTimeout {
+            replies++
+        }
+    }
+    if replies < 2 {
+        return
+    }
+    jitter := calcJitter(last, deadTimeout, gaps)
+    t.alerts.update(alert{
+        Host:      t.name(),
+        Metric:    "jitter_ms",
+        Value:     jitter,
+        Threshold: limit,
+        Time:      time.Now(),
+    }, jitter > limit, handlers)
+}
+
+// checkAlerts runs all alert checks configured in cfg for t. t.mutex must
+// be held.
+func checkAlerts(t *target, cfg *config, handlers []alertHandler) {
+    checkWindowChange(t, cfg.deadTimeout, cfg.window, cfg.alertPct, handlers)
+    checkThresholds(t, cfg.deadTimeout, cfg.window, cfg.alertRTT, cfg.alertLoss, handlers)
+    checkJitter(t, cfg.deadTimeout, cfg.window, cfg.alertJit, cfg.jitterGaps, handlers)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+// breach is a run of -window samples of a target beyond -warn or -crit.
+type breach struct {
+    status   int // nagiosWarning or nagiosCritical
+    from, to time.Time
+    worstRTT float64 // highest window average, 0 if no window had replies
+    worstPct float64 // highest window loss
+}
+
+// runAnalyze reads the -analyze export, feeds it through the stats like a
+// replay without pinging anything, and prints the summary of every target
+// with the periods that broke -warn or -crit. It returns the worst status
+// as a Nagios exit code.
+func runAnalyze(cfg *config) int {
+    records, err := readExport(cfg.analyze)
+    if err != nil {
+        fmt.Printf("Could not read export file %s: %v. Exiting.\n", cfg.analyze, err)
+        return exitError
+    }
+    records, notes := splitNotes(records)
+    if len(records) == 0 {
+        fmt.Printf("Export file %s contains no samples. Exiting.\n", cfg.analyze)
+        return exitError
+    }
+    targets, owners := replayTargets(records)
+    for _, t := range targets {
+        newHostStatus(t, cfg)
+    }
+    replay(context.Background(), records, owners, 0, cfg.deadTimeout)
+
+    first, last := records[0].Time, records[0].Time
+    for _, record := range records {
+        if record.Time.Before(first) {
+            first = record.Time
+        }
+        if record.Time.After(last) {
+            last = record.Time
+        }
+    }
+    fmt.Printf("Analysis of %s: %d samples from %s to %s (%s)\n", cfg.analyze, len(records),
+        first.Format("2006-01-02 15:04:05"), last.Format("2006-01-02 15:04:05"), last.Sub(first).Round(time.Second))
+
+    // The run time of the stats is the span of the capture.
+    startTime := time.Now().Add(-last.Sub(first))
+    status := nagiosOK
+    for _, t := range targets {
+        t.mutex.Lock()
+        st := computeStats(t, cfg, startTime)
+        breaches := findBreaches(t, cfg)
+        t.mutex.Unlock()
+
+        fmt.Print(summaryText(t, st))
+        targetStatus := nagiosOK
+        switch {
+        case cfg.critLimit.exceeded(st):
+            targetStatus = nagiosCritical
+        case cfg.warnLimit.exceeded(st):
+            targetStatus = nagiosWarning
+        }
+        if targetStatus != nagiosOK {
+            fmt.Printf("%s overall: avg %s, loss %.1f%%\n", nagiosStatusNames[targetStatus], formatRTT(st, st.Avg), st.PctLost)
+        }
+        for _, b := range breaches {
+            avg := "n/a"
+            if b.worstRTT > 0 {
+                avg = fmt.Sprintf("%.2f ms", b.worstRTT)
+            }
+            fmt.Printf("%s %s - %s: window avg up to %s, loss up to %.1f%%\n", nagiosStatusNames[b.status],
+                b.from.Format("15:04:05"), b.to.Format("15:04:05"), avg, b.worstPct)
+            targetStatus = max(targetStatus, b.status)
+        }
+        status = max(status, targetStatus)
+    }
+    for _, n := range notes {
+        fmt.Printf("Note %s: %s\n", n.Time.Format("15:04:05"), n.Text)
+    }
+    return status
+}
+
+// findBreaches slides a window of cfg.window samples over the samples of t
+// and returns the runs of windows beyond -crit or -warn, each from the
+// first probe of its first window to the last probe of its last one.
+// t.mutex must be held.
+func findBreaches(t *target, cfg *config) []breach {
+    window := min(cfg.window, len(t.times))
+    if window <= 0 || (cfg.warnLimit == threshold{} && cfg.critLimit == threshold{}) {
+        return nil
+    }
+    var breaches []breach
+    var current *breach
+    sum, replies := 0.0, 0
+    for i, v := range t.times {
+        if v != cfg.deadTimeout {
+            sum += v
+            replies++
+        }
+        if i >= window {
+            if old := t.times[i-window]; old != cfg.deadTimeout {
+                sum -= old
+                replies--
+            }
+        }
+        if i < window-1 {
+            continue
+        }
+
+        st := Stats{Valid: replies, PctLost: float64(window-replies) / float64(window) * 100}
+        if replies > 0 {
+            st.Avg = sum / float64(replies)
+        }
+        status := nagiosOK
+        switch {
+        case cfg.critLimit.exceeded(st):
+            status = nagiosCritical
+        case cfg.warnLimit.exceeded(st):
+            status = nagiosWarning
+        }
+        if current != nil && current.status != status {
+            breaches = append(breaches, *current)
+            current = nil
+        }
+        if status == nagiosOK {
+            continue
+        }
+        if current == nil {
+            current = &breach{status: status, from: t.stamps[i-window+1]}
+        }
+        current.to = t.stamps[i]
+        current.worstRTT = max(current.worstRTT, st.Avg)
+        current.worstPct = max(current.worstPct, st.PctLost)
+    }
+    if current != nil {
+        breaches = append(breaches, *current)
+    }
+    return breaches
+}
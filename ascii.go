@@ -0,0 +1,141 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "os/signal"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// Size of the -ascii-plot drawing area in characters.
+const (
+    asciiPlotWidth  = 72
+    asciiPlotHeight = 12
+)
+
+// asciiMarks are the plot characters of the targets, in target order.
+const asciiMarks = "*+ox#@%&"
+
+// asciiLost marks a lost probe on the X axis.
+const asciiLost = '!'
+
+// runASCIIPlot prints the latency graph as plain ASCII every
+// cfg.asciiPlot, for terminals and logs that keep only text, until
+// interrupted.
+func runASCIIPlot(cfg *config, targets []*target, alertHandlers []alertHandler, running *bool) {
+    ticker := time.NewTicker(cfg.asciiPlot)
+    defer ticker.Stop()
+
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+    for *running {
+        select {
+        case <-sigs:
+            *running = false
+        case <-ticker.C:
+            for _, t := range targets {
+                t.mutex.Lock()
+                checkAlerts(t, cfg, alertHandlers)
+                t.mutex.Unlock()
+            }
+            fmt.Printf("%s %s\n%s\n", time.Now().Format("2006-01-02 15:04:05"), plotTitle(targets), asciiPlot(cfg, targets))
+        }
+    }
+}
+
+// asciiPlot draws the last asciiPlotWidth samples of every target, one
+// column per sample, with lost probes marked on the X axis.
+func asciiPlot(cfg *config, targets []*target) string {
+    tails := make([][]float64, len(targets))
+    maxRTT := 0.0
+    samples := 0
+    var span time.Duration
+    for i, t := range targets {
+        t.mutex.Lock()
+        start := len(t.times) - asciiPlotWidth
+        if start < 0 {
+            start = 0
+        }
+        tails[i] = append([]float64(nil), t.times[start:]...)
+        if len(t.stamps)-start > 1 {
+            if d := t.stamps[len(t.stamps)-1].Sub(t.stamps[start]); d > span {
+                span = d
+            }
+        }
+        t.mutex.Unlock()
+        for _, v := range tails[i] {
+            if v != cfg.deadTimeout {
+                maxRTT = math.Max(maxRTT, v)
+            }
+        }
+        if len(tails[i]) > samples {
+            samples = len(tails[i])
+        }
+    }
+    if maxRTT == 0 {
+        maxRTT = 1
+    }
+
+    rows := make([][]byte, asciiPlotHeight)
+    for r := range rows {
+        rows[r] = []byte(strings.Repeat(" ", asciiPlotWidth))
+    }
+    axis := []byte(strings.Repeat("-", asciiPlotWidth))
+    for i, tail := range tails {
+        mark := asciiMarks[i%len(asciiMarks)]
+        for col, v := range tail {
+            if v == cfg.deadTimeout {
+                axis[col] = asciiLost
+                continue
+            }
+            row := int(math.Round(v / maxRTT * (asciiPlotHeight - 1)))
+            rows[asciiPlotHeight-1-row][col] = mark
+        }
+    }
+
+    var b strings.Builder
+    for r, line := range rows {
+        label := ""
+        switch r {
+        case 0:
+            label = fmt.Sprintf("%.1f ms", maxRTT)
+        case asciiPlotHeight / 2:
+            label = fmt.Sprintf("%.1f ms", maxRTT*float64(asciiPlotHeight-1-r)/(asciiPlotHeight-1))
+        case asciiPlotHeight - 1:
+            label = "0.0 ms"
+        }
+        fmt.Fprintf(&b, "%10s |%s\n", label, strings.TrimRight(string(line), " "))
+    }
+    fmt.Fprintf(&b, "%10s +%s\n", "", axis)
+    fmt.Fprintf(&b, "%10s  last %d samples over %v, %c = lost\n", "", samples, span.Round(time.Second), asciiLost)
+    legend := make([]string, len(targets))
+    for i, t := range targets {
+        legend[i] = fmt.Sprintf("%c %s", asciiMarks[i%len(asciiMarks)], t.name())
+    }
+    fmt.Fprintf(&b, "%10s  %s\n", "", strings.Join(legend, "  "))
+    return b.String()
+}
+
+// captureScreen writes what the graph view shows to a timestamped text
+// file for the 'c' key: the title, the ASCII plot and the stats of every
+// target without markup or the key help. It returns the file name.
+func captureScreen(title string, cfg *config, targets []*target, statsTexts []string) (string, error) {
+    now := time.Now()
+    path := now.Format("pinggraph-20060102-150405.txt")
+    var b strings.Builder
+    fmt.Fprintf(&b, "%s %s\n%s", now.Format("2006-01-02 15:04:05"), title, asciiPlot(cfg, targets))
+    for i, t := range targets {
+        fmt.Fprintf(&b, "\n--- %s ---\n", t.name())
+        for _, line := range strings.Split(strings.TrimRight(statsTexts[i], "\n"), "\n") {
+            if strings.HasPrefix(line, "Press ") {
+                continue
+            }
+            b.WriteString(styleMarkup.ReplaceAllString(line, "$1") + "\n")
+        }
+    }
+    return path, os.WriteFile(path, []byte(b.String()), 0644)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "io"
+    "sync"
+    "time"
+)
+
+// audioTicker rings the terminal bell for every probe result, like a Geiger
+// counter of network health: one beep for a reply, two for a lost probe.
+// Terminals have only a single bell tone, so loss is told apart by the
+// double beep. Beeps closer together than minGap are dropped so that fast
+// intervals do not turn into a continuous tone; a loss is never dropped in
+// favour of a reply.
+type audioTicker struct {
+    out    io.Writer
+    minGap time.Duration
+
+    mutex sync.Mutex
+    last  time.Time
+}
+
+func newAudioTicker(out io.Writer, minGap time.Duration) *audioTicker {
+    return &audioTicker{out: out, minGap: minGap}
+}
+
+func (a *audioTicker) observe(t *target, s sample) {
+    a.mutex.Lock()
+    defer a.mutex.Unlock()
+
+    now := time.Now()
+    if !s.Lost && now.Sub(a.last) < a.minGap {
+        return
+    }
+    a.last = now
+
+    if s.Lost {
+        io.WriteString(a.out, "\a\a")
+    } else {
+        io.WriteString(a.out, "\a")
+    }
+}
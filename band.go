@@ -0,0 +1,42 @@
+package main
+
+import (
+    "math"
+    "sort"
+)
+
+const (
+    // bandLow and bandHigh are the percentiles -band shades between.
+    bandLow  = 10
+    bandHigh = 90
+    // bandMinReplies is how many replies the trailing window needs before
+    // a band is drawn, fewer make the percentiles meaningless.
+    bandMinReplies = 10
+)
+
+// bandSeries returns the -band edges for the samples times[from:]: the
+// p10 and p90 of the replies among the window samples before each one, so
+// a sample is compared with the history it follows and not with itself.
+// Lost probes are left out. The edges are NaN while there are fewer than
+// bandMinReplies replies.
+func bandSeries(times []float64, from int, deadTimeout float64, window int) (low, high []float64) {
+    low = make([]float64, len(times)-from)
+    high = make([]float64, len(times)-from)
+    var sorted []float64
+    for i := from; i < len(times); i++ {
+        sorted = sorted[:0]
+        for _, v := range times[max(0, i-window):i] {
+            if v != deadTimeout && !math.IsNaN(v) {
+                sorted = append(sorted, v)
+            }
+        }
+        if len(sorted) < bandMinReplies {
+            low[i-from], high[i-from] = math.NaN(), math.NaN()
+            continue
+        }
+        sort.Float64s(sorted)
+        low[i-from] = percentile(sorted, bandLow)
+        high[i-from] = percentile(sorted, bandHigh)
+    }
+    return low, high
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// Exit codes of the batch modes.
+const (
+    exitOK        = 0 // every target met the -fail-* thresholds
+    exitError     = 1 // bad usage or the probes could not be sent
+    exitUnhealthy = 2 // a -fail-loss or -fail-rtt threshold was exceeded
+)
+
+// runBatch waits for the pingers to finish their -n probes or the -duration
+// to pass, or for an interrupt, then prints a summary for every target, or
+// the -nagios check result, and returns the exit code. -classic runs end
+// here as well, by default on the interrupt like ping.
+func runBatch(cfg *config, targets []*target, startTime time.Time, wg *sync.WaitGroup, cancel func(), running *bool) int {
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+    select {
+    case <-done:
+    case <-sigs:
+        cancel()
+        <-done
+    }
+    if !*running {
+        if cfg.nagios {
+            fmt.Println("PING UNKNOWN - could not send probes")
+            return nagiosUnknown
+        }
+        return exitError
+    }
+
+    stats := make([]Stats, len(targets))
+    for i, t := range targets {
+        t.mutex.Lock()
+        stats[i] = computeStats(t, cfg, startTime)
+        t.mutex.Unlock()
+    }
+    if cfg.nagios {
+        return nagiosCheck(cfg.warnLimit, cfg.critLimit, targets, stats)
+    }
+
+    for i, t := range targets {
+        if cfg.classic {
+            fmt.Print(classicSummary(t, stats[i]))
+        } else {
+            fmt.Print(summaryText(t, stats[i]))
+        }
+    }
+
+    // Scripts test ping's exit status for "got an answer".
+    if cfg.classic {
+        for _, st := range stats {
+            if st.Valid == 0 {
+                return exitError
+            }
+        }
+    }
+
+    if cfg.source != "" {
+        for i, t := range targets {
+            fmt.Println(sourceVerdict(cfg.source, t, stats[i]))
+        }
+    }
+
+    failures := healthFailures(cfg, targets, stats)
+    for _, failure := range failures {
+        fmt.Println("FAIL: " + failure)
+    }
+    if len(failures) > 0 {
+        return exitUnhealthy
+    }
+    return exitOK
+}
+
+// summaryText renders the final statistics of a target in the style of
+// ping(8).
+func summaryText(t *target, st Stats) string {
+    warmup := ""
+    if st.NWarmup > 0 {
+        warmup = fmt.Sprintf(" (after %d warmup)", st.NWarmup)
+    }
+    text := fmt.Sprintf("--- %s ping statistics ---\n%d probes sent%s, %d replies, %.1f%% lost, run time %.1f s\n",
+        t.name(), st.Total, warmup, st.Valid, st.PctLost, st.RunTime)
+    if st.Valid > 0 {
+        text += fmt.Sprintf("rtt min/avg/max/p95/stddev = %.2f/%.2f/%.2f/%.2f/%.2f ms, cv %s, jitter %.2f ms\n",
+            st.Min, st.Avg, st.Max, st.P95, st.StdDev, formatCV(st), st.Jitter)
+    }
+    if len(st.Responders) > 0 {
+        text += formatResponders(st.Responders, 0)
+    }
+    if st.Race != nil {
+        text += formatRace(*st.Race)
+    }
+    if st.MTU != "" {
+        text += "MTU: " + st.MTU + "\n"
+    }
+    if st.OWD != "" {
+        text += "One-way delay: " + st.OWD + "\n"
+    }
+    return text
+}
+
+// sourceVerdict tells what the replies to probes sent from the -source
+// address say about unicast RPF filtering on the path to t. Replies mean
+// the probes were not dropped for their source; no replies can have other
+// reasons too.
+func sourceVerdict(source string, t *target, st Stats) string {
+    if st.Valid > 0 {
+        return fmt.Sprintf("Source %s: %d of %d probes to %s answered, not dropped by source address (uRPF) filtering", source, st.Valid, st.Total, t.name())
+    }
+    return fmt.Sprintf("Source %s: no probe to %s answered, dropped by uRPF or other filtering, or the replies are not routed back to %s", source, t.name(), source)
+}
+
+// healthFailures lists the -fail-loss and -fail-rtt thresholds each target
+// exceeded. A target without any reply fails -fail-rtt as well.
+func healthFailures(cfg *config, targets []*target, stats []Stats) []string {
+    var failures []string
+    for i, t := range targets {
+        st := stats[i]
+        if st.PctLost > cfg.failLoss {
+            failures = append(failures, fmt.Sprintf("%s loss %.1f%% exceeds %.1f%%", t.name(), st.PctLost, cfg.failLoss))
+        }
+        if cfg.failRTT > 0 {
+            switch {
+            case st.Valid == 0:
+                failures = append(failures, fmt.Sprintf("%s has no replies to measure p95 RTT", t.name()))
+            case st.P95 > cfg.failRTT:
+                failures = append(failures, fmt.Sprintf("%s p95 RTT %.2f ms exceeds %.2f ms", t.name(), st.P95, cfg.failRTT))
+            }
+        }
+    }
+    return failures
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "encoding/csv"
+    "os"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+)
+
+var bucketHeader = []string{"time", "host", "addr", "count", "loss_pct", "min_ms", "avg_ms", "max_ms", "p95_ms", "jitter_ms"}
+
+// bucketWriter writes a CSV row of stats per target and -bucket window
+// for -export-buckets, aligned to the wall clock like -aggregate. The
+// numbers come from the same code as the stats panel, run over the
+// samples of the window.
+type bucketWriter struct {
+    cfg   *config
+    width time.Duration
+    // grace is how long after its end a window may still get samples: a
+    // lost probe is only recorded when it times out.
+    grace time.Duration
+
+    mutex   sync.Mutex
+    file    *os.File
+    csv     *csv.Writer
+    targets []*target // in order of their first sample
+    open    map[*target]map[time.Time]*openBucket
+    latest  map[*target]time.Time // latest send time seen
+}
+
+// openBucket collects the samples of a window that is not written yet.
+type openBucket struct {
+    times []float64
+    seqs  []int
+}
+
+func newBucketWriter(path string, cfg *config) (*bucketWriter, error) {
+    file, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    w := &bucketWriter{
+        cfg:    cfg,
+        width:  cfg.bucket,
+        grace:  time.Duration(cfg.deadTimeout * float64(time.Millisecond)),
+        file:   file,
+        csv:    csv.NewWriter(file),
+        open:   make(map[*target]map[time.Time]*openBucket),
+        latest: make(map[*target]time.Time),
+    }
+    w.csv.Write(bucketHeader)
+    w.csv.Flush()
+    return w, w.csv.Error()
+}
+
+func (w *bucketWriter) observe(t *target, s sample) {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    buckets, ok := w.open[t]
+    if !ok {
+        buckets = make(map[time.Time]*openBucket)
+        w.open[t] = buckets
+        w.targets = append(w.targets, t)
+    }
+    start := s.Time.Truncate(w.width)
+    b, ok := buckets[start]
+    if !ok {
+        b = &openBucket{}
+        buckets[start] = b
+    }
+    b.times = append(b.times, s.RTT)
+    b.seqs = append(b.seqs, s.Seq)
+    if s.Time.After(w.latest[t]) {
+        w.latest[t] = s.Time
+    }
+    w.writeUntil(t, w.latest[t].Add(-w.width-w.grace))
+}
+
+// flush writes the windows still open, the last one usually incomplete.
+func (w *bucketWriter) flush() {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    for _, t := range w.targets {
+        w.writeUntil(t, w.latest[t])
+    }
+}
+
+// writeUntil writes and forgets the open windows of t that start before
+// the given time, oldest first. w.mutex must be held.
+func (w *bucketWriter) writeUntil(t *target, before time.Time) {
+    var starts []time.Time
+    for start := range w.open[t] {
+        if !start.After(before) {
+            starts = append(starts, start)
+        }
+    }
+    sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+    for _, start := range starts {
+        w.write(t, start, w.open[t][start])
+        delete(w.open[t], start)
+    }
+    w.csv.Flush()
+}
+
+// write formats the row of one window. Without replies the RTT columns
+// stay empty, as 0 would read as an instant reply.
+func (w *bucketWriter) write(t *target, start time.Time, b *openBucket) {
+    var st Stats
+    scanStats(&st, &target{times: b.times, pings: b.seqs}, w.cfg)
+    if st.Total == 0 {
+        // Only -warmup samples.
+        return
+    }
+    ms := func(v float64) string {
+        if st.Valid == 0 {
+            return ""
+        }
+        return strconv.FormatFloat(v, 'f', 3, 64)
+    }
+    w.csv.Write([]string{
+        start.Format(time.RFC3339Nano),
+        t.host,
+        t.addr,
+        strconv.Itoa(st.Total),
+        strconv.FormatFloat(st.PctLost, 'f', 2, 64),
+        ms(st.Min),
+        ms(st.Avg),
+        ms(st.Max),
+        ms(st.P95),
+        ms(st.Jitter),
+    })
+}
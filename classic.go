@@ -0,0 +1,95 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "strings"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+// classicHeader prints the first line of iputils ping for -classic.
+func classicHeader(t *target, payloadSize int) {
+    ipHeader := 20
+    if t.useIPv6 {
+        ipHeader = 40
+    }
+    fmt.Printf("PING %s (%s) %d(%d) bytes of data.\n", t.host, t.addr, payloadSize,
+        payloadSize+pinger.ICMPHeaderSize+ipHeader)
+}
+
+// classicLine prints the line iputils ping prints for a result, nothing
+// for a probe that timed out, as ping does without -O.
+func classicLine(r pinger.Result) {
+    switch r.Status {
+    case pinger.StatusReply:
+        line := fmt.Sprintf("%d bytes from %s: icmp_seq=%d", pinger.ICMPHeaderSize+r.PayloadLen, peerIP(r.Peer), r.Seq)
+        if r.TTL > 0 {
+            line += fmt.Sprintf(" ttl=%d", r.TTL)
+        }
+        line += " time=" + classicTime(r.RTT) + " ms"
+        if r.Duplicate {
+            line += " (DUP!)"
+        }
+        if r.Truncated {
+            line += " (truncated)"
+        }
+        fmt.Println(line)
+    case pinger.StatusUnreachable:
+        fmt.Printf("From %s icmp_seq=%d Destination %s\n", peerIP(r.Peer), r.Seq, titleWords(r.Reason))
+    case pinger.StatusSendError, pinger.StatusRecvError:
+        fmt.Printf("ping: icmp_seq=%d %v\n", r.Seq, r.Err)
+    }
+}
+
+// classicTime formats an RTT with the precision iputils ping uses: three
+// decimals below 1 ms, one digit less for every power of ten above.
+func classicTime(rtt time.Duration) string {
+    ms := float64(rtt) / float64(time.Millisecond)
+    switch {
+    case ms >= 100:
+        return fmt.Sprintf("%.0f", ms)
+    case ms >= 10:
+        return fmt.Sprintf("%.1f", ms)
+    case ms >= 1:
+        return fmt.Sprintf("%.2f", ms)
+    }
+    return fmt.Sprintf("%.3f", ms)
+}
+
+// classicSummary renders the final statistics block of iputils ping.
+func classicSummary(t *target, st Stats) string {
+    counts := fmt.Sprintf("%d packets transmitted, %d received", st.Total, st.Valid)
+    errors := 0
+    for _, n := range st.Unreachable {
+        errors += n
+    }
+    if errors > 0 {
+        counts += fmt.Sprintf(", +%d errors", errors)
+    }
+    text := fmt.Sprintf("\n--- %s ping statistics ---\n%s, %g%% packet loss, time %.0fms\n",
+        t.host, counts, float32(st.PctLost), st.RunTime*1000)
+    if st.Valid > 0 {
+        text += fmt.Sprintf("rtt min/avg/max/mdev = %.3f/%.3f/%.3f/%.3f ms\n", st.Min, st.Avg, st.Max, st.StdDev)
+    }
+    return text
+}
+
+// peerIP returns the address of a reply sender.
+func peerIP(addr net.Addr) string {
+    if addr == nil {
+        return "?"
+    }
+    return addr.String()
+}
+
+// titleWords capitalizes every word, "host unreachable" becomes "Host
+// Unreachable" as in ping's messages.
+func titleWords(s string) string {
+    words := strings.Fields(s)
+    for i, w := range words {
+        words[i] = strings.ToUpper(w[:1]) + w[1:]
+    }
+    return strings.Join(words, " ")
+}
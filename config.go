@@ -0,0 +1,358 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+    "text/template"
+    "time"
+)
+
+// config holds the command-line settings.
+type config struct {
+    timeout     int
+    slowRTT     int
+    hysteresis  int
+    lossTol     int
+    interval    float64
+    pattern     string
+    deadTimeout float64
+    useIPv6     bool
+    prefer      string
+    payloadSize int
+    bufSize     int
+    verify      string
+    jitterGaps  string
+    gapStyle    string
+    fill        bool
+    band        int
+    yMax        float64
+    theme       string
+    flowLabel   int
+    source      string
+    echoID      int
+    icmpType    int
+    icmpCode    int
+    randomID    bool
+    dontFrag    bool
+    mtuCheck    bool
+    owd         bool
+    addrSelect  string
+    audio       bool
+    audioGap    time.Duration
+    influxURL   string
+    influxFlush time.Duration
+    otlpURL     string
+    otlpPeriod  time.Duration
+    plotPoints  int
+    export      string
+    bucketFile  string
+    bucket      time.Duration
+    fifo        string
+    web         string
+    snapshot    string
+    snapOnExit  bool
+    note        string
+    replayFile  string
+    analyze     string
+    replaySpeed float64
+    window      int
+    alertPct    float64
+    alertBell   bool
+    refresh     time.Duration
+    oneline     bool
+    smallTerm   string
+    diff        bool
+    splitScale  bool
+    asciiPlot   time.Duration
+    sweep       string
+    sweepSizes  []int
+    sweepCount  int
+    sweepCycles int
+    daemon      bool
+    classic     bool
+    rawOut      bool
+    priority    string
+    rawLost     string
+    bloatRatio  float64
+    aggregate   time.Duration
+    lossWindow  time.Duration
+    alertRTT    float64
+    alertLoss   float64
+    alertJit    float64
+    webhook     string
+    notify      bool
+    validOnly   bool
+    debug       bool
+    count       int
+    duration    time.Duration
+    maxBytes    int64
+    maxMemMB    int
+    selfCheck   time.Duration
+    failLoss    float64
+    failRTT     float64
+    nagios      bool
+    warn        string
+    crit        string
+    verbose     bool
+    logFile     string
+    broadcast   bool
+    hwTimestamp bool
+    lowPower    bool
+    drain       bool
+    dnsInterval time.Duration
+    dnsRetries  int
+    plotDNS     bool
+    dualStack   bool
+    warmup      int
+    central     string
+    trendWindow time.Duration
+    movingAvg   int
+    statsTmpl   string
+    baseline    float64
+    untilUp     bool
+    untilDown   bool
+    untilLimit  time.Duration
+
+    // warnLimit and critLimit are the parsed -warn and -crit values.
+    warnLimit threshold
+    critLimit threshold
+    // schedule holds the gaps between the probes of the parsed -pattern.
+    schedule []time.Duration
+    // statsLayout is the parsed -stats-template, nil for the built-in
+    // layout.
+    statsLayout *template.Template
+}
+
+// minInterval is the shortest -i accepted, below it the sender cannot keep
+// the pace anyway.
+const minInterval = time.Millisecond
+
+// parseFlags defines and parses the command-line flags.
+func parseFlags() *config {
+    cfg := &config{}
+    cfg.timeout = 150
+    flag.Var(millisFlag{&cfg.timeout}, "W", "Timeout for each ping request, in milliseconds or as a `duration` like 1s")
+    flag.IntVar(&cfg.lossTol, "loss-tolerance", 0, "Consecutive lost probes that still count as up for the uptime stats, more end the uptime (0 = any loss)")
+    flag.IntVar(&cfg.hysteresis, "hysteresis", 3, "Consecutive lost or slow probes that make a host DOWN or DEGRADED, and good replies that make it UP again")
+    flag.IntVar(&cfg.slowRTT, "slow", 0, "Replies slower than this many milliseconds count as slow in the stats and colors (0 = the -W timeout)")
+    cfg.interval = 0.1
+    flag.Var(unitFlag{&cfg.interval, time.Second}, "i", "Interval between pings, in seconds or as a `duration` like 20ms")
+    flag.StringVar(&cfg.pattern, "pattern", "", "Send bursts instead of a probe every -i, e.g. 5x50ms,1s: 5 probes 50 ms apart, then 1 s idle, repeated")
+    cfg.deadTimeout = 500
+    flag.Var(unitFlag{&cfg.deadTimeout, time.Millisecond}, "D", "Execution timeout for each ping command, in milliseconds or as a `duration` like 2s (max 10000 ms)")
+    flag.BoolVar(&cfg.useIPv6, "6", false, "Use IPv6 for the ping (default: picked from the addresses the host resolves to)")
+    flag.StringVar(&cfg.prefer, "prefer", "4", "Address family to use when a host has both IPv4 and IPv6 addresses: 4 or 6")
+    flag.BoolVar(&cfg.dualStack, "happy-eyeballs", false, "Ping the IPv4 and the IPv6 address of every host and report which family wins, as a happy eyeballs client would see it")
+    flag.IntVar(&cfg.payloadSize, "s", 56, "Number of data bytes to send in each ping request")
+    flag.IntVar(&cfg.bufSize, "bufsize", 0, "Size of the reply read buffer in bytes (0 = derived from -s)")
+    flag.StringVar(&cfg.verify, "payload-check", "none", "Verify the reply payload: none, full (byte by byte) or hash (a CRC-32C of the sequence number and 256 sampled bytes carried in the payload, the same cost for any -s)")
+    flag.StringVar(&cfg.theme, "theme", "dark", "Color scheme of the graph: dark, light (for terminals with a light background) or mono (terminal colors only)")
+    flag.StringVar(&cfg.gapStyle, "gap-style", "break", "How gaps in the plot lines, e.g. losses with -valid-only, are drawn: break, interpolate (dashed line across) or dim (the same in grey)")
+    flag.BoolVar(&cfg.fill, "fill", false, "Fill the area under the RTT line of every target in its color, so lost probes at -D stand out as full columns")
+    flag.Float64Var(&cfg.yMax, "ymax", 0, "Lock the top of the Y axis at this RTT in ms on both scales instead of following the data, 'y' locks the current top or unlocks it (0 = follow)")
+    flag.IntVar(&cfg.band, "band", 0, "Shade the p10 to p90 range of the RTT over this many preceding samples behind every line, so unusual latency stands out from the usual (0 = off)")
+    flag.StringVar(&cfg.jitterGaps, "jitter-gaps", "skip", "How lost probes affect jitter: skip (replies around a loss count as neighbours) or break (a loss separates them)")
+    flag.BoolVar(&cfg.dontFrag, "df", false, "Forbid fragmenting the requests (IPv4 DF bit), so probes above the path MTU fail (Linux only)")
+    flag.BoolVar(&cfg.mtuCheck, "mtu-check", false, "Detect MTU black holes: send small probes next to the -s ones, all with -df, and when only the large ones vanish search the largest size that gets through (Linux only)")
+    flag.BoolVar(&cfg.owd, "owd", false, "Send ICMP timestamp requests next to the echo requests and show the delay variation of the forward and return path separately (IPv4 only)")
+    flag.IntVar(&cfg.icmpType, "icmp-type", -1, "Advanced, for protocol testing: send ICMP messages of this type with an echo body instead of echo requests; replies may not be parseable and are counted against the oldest probe")
+    flag.IntVar(&cfg.icmpCode, "icmp-code", -1, "Advanced, for protocol testing: ICMP code of the requests, see -icmp-type (default 0)")
+    flag.IntVar(&cfg.echoID, "id", -1, "ICMP echo identifier of the first target, the next targets count up from it (default: from the process ID)")
+    flag.BoolVar(&cfg.randomID, "random-id", false, "Pick a random ICMP echo identifier at startup instead of one from the process ID, which it would reveal")
+    flag.StringVar(&cfg.source, "source", "", "Send the probes from this address of the host, e.g. to test unicast RPF filtering with the address of another interface; only on networks you are authorized to test")
+    flag.IntVar(&cfg.flowLabel, "flowlabel", 0, "IPv6 flow label for the requests, 0 leaves it unset (Linux only)")
+    flag.StringVar(&cfg.addrSelect, "addr-select", "first", "Which resolved address to ping: first, all or index:N")
+    flag.BoolVar(&cfg.audio, "audio", false, "Beep on every reply (double beep on loss) and color the stats title by the last result")
+    flag.DurationVar(&cfg.audioGap, "audio-gap", 250*time.Millisecond, "Minimum time between two reply beeps with -audio")
+    flag.StringVar(&cfg.influxURL, "influx", "", "Stream samples as InfluxDB line protocol to udp://host:port or an http(s) write URL")
+    flag.IntVar(&cfg.plotPoints, "plot-points", 0, "Number of most recent samples to plot (0 = as many as fit the plot width)")
+    flag.DurationVar(&cfg.influxFlush, "influx-flush", 5*time.Second, "Flush interval for -influx batches")
+    flag.StringVar(&cfg.otlpURL, "otlp", "", "Export RTT and loss metrics over OTLP/HTTP to this collector URL, e.g. http://localhost:4318")
+    flag.DurationVar(&cfg.otlpPeriod, "otlp-interval", 10*time.Second, "Export interval for -otlp metrics")
+    flag.StringVar(&cfg.web, "web", "", "Serve a live chart and the stats to browsers on this address, e.g. :8080")
+    flag.StringVar(&cfg.fifo, "fifo", "", "Write the current stats of all targets as a JSON line to this FIFO every -refresh, created if missing, for local dashboards (Unix only)")
+    flag.StringVar(&cfg.export, "export", "", "Write every sample to this file (CSV, or JSON lines for .json/.jsonl)")
+    flag.StringVar(&cfg.bucketFile, "export-buckets", "", "Write a CSV row per target and -bucket window to this file: count, loss %, min, avg, max, p95 and jitter")
+    flag.DurationVar(&cfg.bucket, "bucket", time.Minute, "Window of the -export-buckets rows, aligned to the clock")
+    flag.StringVar(&cfg.snapshot, "snapshot", "", "Image file the 'p' key and -snapshot-on-exit save the graph to, PNG for .png and SVG otherwise (default pinggraph-TIME.svg)")
+    flag.StringVar(&cfg.note, "note", "", "Note about the session, e.g. \"before firmware upgrade\", added to the events, -export and -log; 'n' adds more in the graph view")
+    flag.BoolVar(&cfg.snapOnExit, "snapshot-on-exit", false, "Save the graph of the whole run as an image on exit, see -snapshot")
+    flag.StringVar(&cfg.replayFile, "replay", "", "Replay samples from a file written by -export instead of pinging")
+    flag.Float64Var(&cfg.replaySpeed, "replay-speed", 1, "Replay speed factor for -replay (0 = all at once)")
+    flag.IntVar(&cfg.window, "window", 100, "Number of samples per window for window-to-window comparisons")
+    flag.Float64Var(&cfg.alertPct, "alert-pct", 0, "Alert when the window average rises by more than this percentage over the previous window (0 = off)")
+    flag.BoolVar(&cfg.alertBell, "alert-bell", false, "Ring the terminal bell when an alert starts")
+    flag.DurationVar(&cfg.refresh, "refresh", time.Second, "How often the display is updated")
+    flag.BoolVar(&cfg.lowPower, "low-power", false, "Save power on long runs: update the graph every 10s while there is no loss or slow reply, and keep the stats incrementally")
+    flag.BoolVar(&cfg.diff, "diff", false, "Ping two hosts and plot the RTT of the first minus the second, positive when the first is slower")
+    flag.BoolVar(&cfg.splitScale, "split-scale", false, "Show the linear and the log scale graph side by side, toggled with 'L'")
+    flag.BoolVar(&cfg.oneline, "oneline", false, "Print a single continuously updated status line instead of the graph")
+    flag.StringVar(&cfg.smallTerm, "small-terminal", "wait", "What the graph view shows while the terminal is smaller than 40x12: wait (a message until it is resized) or oneline (the -oneline status)")
+    flag.DurationVar(&cfg.asciiPlot, "ascii-plot", 0, "Print the graph as plain ASCII at this interval instead of showing it, to -log with -daemon (0 = off)")
+    flag.StringVar(&cfg.sweep, "sweep", "", "Ping every payload size from MIN:MAX[:STEP] bytes in turn, e.g. 64:1472:64, and print a chart of RTT against size instead of the graph")
+    flag.IntVar(&cfg.sweepCount, "sweep-count", 5, "Probes sent per payload size and pass with -sweep")
+    flag.IntVar(&cfg.sweepCycles, "sweep-cycles", 1, "Passes over all -sweep sizes before exiting, the chart is printed after each (0 = until interrupted)")
+    flag.StringVar(&cfg.priority, "priority", "", "Run at a higher scheduling priority for steadier timing: high (nice -10) or realtime (SCHED_FIFO), needs root or CAP_SYS_NICE (Linux only)")
+    flag.BoolVar(&cfg.rawOut, "raw", false, "Print every sample as a bare \"seq<TAB>rtt\" line in ms instead of the graph, for gnuplot and other tools; with several hosts the address comes first")
+    flag.StringVar(&cfg.rawLost, "raw-lost", "NaN", "What -raw prints as the RTT of a lost probe, e.g. -raw-lost= for an empty field")
+    flag.BoolVar(&cfg.classic, "classic", false, "Print the output of iputils ping instead of the graph, for scripts that parse it")
+    flag.Float64Var(&cfg.bloatRatio, "bloat-ratio", 3, "Flag suspected bufferbloat when p99 latency exceeds p50 by this factor (0 = off)")
+    flag.DurationVar(&cfg.lossWindow, "loss-window", 10*time.Second, "Window of the loss percentage plotted in the loss view, the 'v' key")
+    flag.DurationVar(&cfg.aggregate, "aggregate", 0, "Plot per-window min/avg/max of this width, e.g. 1s, instead of every sample (0 = off)")
+    flag.Float64Var(&cfg.alertRTT, "alert-rtt", 0, "Alert when the average RTT over the last -window samples exceeds this many ms (0 = off)")
+    flag.Float64Var(&cfg.alertLoss, "alert-loss", 0, "Alert when the loss over the last -window samples exceeds this percentage (0 = off)")
+    flag.Float64Var(&cfg.alertJit, "alert-jitter", 0, "Alert when the jitter over the last -window samples exceeds this many ms (0 = off)")
+    flag.StringVar(&cfg.webhook, "webhook", "", "POST every new alert as JSON to this http(s) URL")
+    flag.BoolVar(&cfg.notify, "notify", false, "Show a desktop notification for every new alert (Linux and macOS)")
+    flag.BoolVar(&cfg.validOnly, "valid-only", false, "Plot only successful replies, lost probes leave gaps in the line (stats still include them)")
+    flag.BoolVar(&cfg.debug, "debug", false, "Hex dump replies that fail to parse or are not echo replies with the per-probe diagnostics, see -verbose and -log")
+    flag.IntVar(&cfg.count, "n", 0, "Send this many probes per target, print a summary and exit (0 = run until quit)")
+    flag.Int64Var(&cfg.maxBytes, "max-bytes", 0, "Stop and print the summary once the probes sent and received this many bytes in total, for metered links (0 = no limit)")
+    flag.DurationVar(&cfg.selfCheck, "self-check", 0, "Before the run, ping every target for up to this long, print PASS or FAIL per target and exit if one gets no reply (0 = off)")
+    flag.IntVar(&cfg.maxMemMB, "max-mem-mb", 0, "Keep the heap within this many MB on long runs by dropping the oldest samples, logged when it happens (0 = no limit)")
+    flag.DurationVar(&cfg.duration, "duration", 0, "Ping for this long, print a summary and exit (0 = run until quit)")
+    flag.Float64Var(&cfg.failLoss, "fail-loss", 100, "With -n, -duration or -max-bytes, exit with code 2 if the loss of any target exceeds this percentage")
+    flag.Float64Var(&cfg.failRTT, "fail-rtt", 0, "With -n, -duration or -max-bytes, exit with code 2 if the p95 RTT of any target exceeds this many ms (0 = off)")
+    flag.BoolVar(&cfg.untilUp, "until-up", false, "Ping until the first reply, print its RTT and exit 0, for wait-for-host scripts")
+    flag.BoolVar(&cfg.untilDown, "until-down", false, "Ping until the first probe goes unanswered and exit 0")
+    flag.DurationVar(&cfg.untilLimit, "timeout-total", 0, "Give up -until-up or -until-down after this long and exit 2 (0 = wait forever)")
+    flag.BoolVar(&cfg.nagios, "nagios", false, "Run as a Nagios/Icinga check: send -n probes (default 5), print one plugin output line and exit 0/1/2/3")
+    flag.StringVar(&cfg.warn, "warn", "", "Warning threshold for -nagios and -analyze as RTT[,LOSS%], e.g. 100,20%, the RTT is drawn on the graph")
+    flag.StringVar(&cfg.crit, "crit", "", "Critical threshold for -nagios and -analyze as RTT[,LOSS%], e.g. 500,60%, the RTT is drawn on the graph")
+    flag.StringVar(&cfg.analyze, "analyze", "", "Print the stats of an -export file and the -window periods beyond -warn or -crit, without pinging, and exit 0/1/2 like -nagios")
+    flag.BoolVar(&cfg.verbose, "verbose", false, "Print per-probe diagnostics even while the graph or status line is shown")
+    flag.StringVar(&cfg.logFile, "log", "", "Append per-probe diagnostics with timestamps to this file")
+    flag.BoolVar(&cfg.daemon, "daemon", false, "Run in the background without a display, writing only to -log, -export, -influx, -otlp and -webhook; SIGHUP reopens the files")
+    flag.BoolVar(&cfg.broadcast, "broadcast", false, "Allow pinging broadcast and multicast addresses and list every host that answers")
+    flag.IntVar(&cfg.dnsRetries, "resolve-retries", 0, "Try to resolve a host name this many more times at startup, waiting 1s, 2s, 4s... up to 30s in between, before giving up (for boot scripts)")
+    flag.DurationVar(&cfg.dnsInterval, "resolve-interval", 0, "Resolve the host names again at this interval to track the DNS resolution time (0 = only at startup)")
+    flag.BoolVar(&cfg.plotDNS, "plot-dns", false, "Plot the DNS resolution time of each target as a magenta line")
+    flag.BoolVar(&cfg.drain, "drain", false, "Discard ICMP messages already queued on the socket at startup and after a reconnection")
+    flag.BoolVar(&cfg.hwTimestamp, "hwtimestamp", false, "Measure RTT against the kernel receive timestamp of each reply instead of the user space clock (Linux only)")
+    flag.IntVar(&cfg.warmup, "warmup", 0, "Leave the first N probes of each target out of the statistics, they are plotted in white")
+    flag.StringVar(&cfg.central, "central", "mean", "Headline typical latency in the stats: mean or median")
+    flag.DurationVar(&cfg.trendWindow, "trend-window", 10*time.Second, "Window compared with the one before it for the latency trend arrow (0 = off)")
+    flag.IntVar(&cfg.movingAvg, "ma", 0, "Show the average of the last N replies as MA(N) in the stats (0 = off)")
+    flag.Float64Var(&cfg.baseline, "baseline", 0, "Draw a reference line at this RTT in ms on the graph, next to the -warn and -crit ones (0 = off)")
+    flag.StringVar(&cfg.statsTmpl, "stats-template", "", "Go text/template for the stats panel over the Stats fields, e.g. '{{ms .Avg}} {{printf \"%.1f\" .PctLost}}%', or @FILE to read it from a file (default the built-in layout)")
+    applyEnv()
+    flag.Parse()
+    return cfg
+}
+
+// unitFlag is a flag counted in unit, which takes a plain number in that
+// unit, as the flag always did, or a duration like 20ms or 1.5s.
+type unitFlag struct {
+    value *float64
+    unit  time.Duration
+}
+
+func (f unitFlag) String() string {
+    if f.value == nil {
+        return ""
+    }
+    return strconv.FormatFloat(*f.value, 'g', -1, 64)
+}
+
+func (f unitFlag) Set(s string) error {
+    v, err := parseUnit(s, f.unit)
+    if err != nil {
+        return err
+    }
+    *f.value = v
+    return nil
+}
+
+// millisFlag is a whole number of milliseconds, given as a number or a
+// duration like 1s.
+type millisFlag struct {
+    value *int
+}
+
+func (f millisFlag) String() string {
+    if f.value == nil {
+        return ""
+    }
+    return strconv.Itoa(*f.value)
+}
+
+func (f millisFlag) Set(s string) error {
+    v, err := parseUnit(s, time.Millisecond)
+    if err != nil {
+        return err
+    }
+    if v != math.Trunc(v) {
+        return fmt.Errorf("%s is not a whole number of milliseconds", s)
+    }
+    *f.value = int(v)
+    return nil
+}
+
+// parseUnit reads a number in unit or a Go duration converted to unit.
+func parseUnit(s string, unit time.Duration) (float64, error) {
+    if v, err := strconv.ParseFloat(s, 64); err == nil {
+        return v, nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil {
+        return 0, fmt.Errorf("want a number or a duration like 20ms")
+    }
+    return float64(d) / float64(unit), nil
+}
+
+// envPrefix starts the environment variables that set flag defaults.
+const envPrefix = "PINGGRAPH_"
+
+// envAliases gives the single letter flags readable environment names.
+var envAliases = map[string]string{
+    "W": "TIMEOUT",
+    "i": "INTERVAL",
+    "D": "DEAD_TIMEOUT",
+    "6": "IPV6",
+    "s": "SIZE",
+    "n": "COUNT",
+}
+
+// envName returns the environment variable for a flag, e.g. PINGGRAPH_ALERT_PCT
+// for -alert-pct and PINGGRAPH_INTERVAL for -i.
+func envName(flagName string) string {
+    if alias, ok := envAliases[flagName]; ok {
+        return envPrefix + alias
+    }
+    return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag that has its environment variable set, so the
+// precedence is defaults < environment < command line.
+func applyEnv() {
+    flag.VisitAll(func(f *flag.Flag) {
+        value, ok := os.LookupEnv(envName(f.Name))
+        if !ok {
+            return
+        }
+        if err := flag.Set(f.Name, value); err != nil {
+            fmt.Printf("Invalid %s value %q: %v. Exiting.\n", envName(f.Name), value, err)
+            os.Exit(1)
+        }
+    })
+}
+
+// batch reports whether the run ends by itself with a summary instead of
+// showing a live display.
+func (cfg *config) batch() bool {
+    return cfg.count > 0 || cfg.duration > 0 || cfg.maxBytes > 0
+}
+
+// raw reports whether -icmp-type or -icmp-code replace the echo requests.
+func (cfg *config) raw() bool {
+    return cfg.icmpType >= 0 || cfg.icmpCode >= 0
+}
+
+// until reports whether -until-up or -until-down waits for a state change.
+func (cfg *config) until() bool {
+    return cfg.untilUp || cfg.untilDown
+}
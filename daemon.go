@@ -0,0 +1,79 @@
+package main
+
+import (
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+)
+
+// daemonOutputs are what a -daemon process writes to: files to open again
+// on SIGHUP and buffered outputs to flush before it exits. Runs in the
+// other modes flush them on exit as well.
+type daemonOutputs struct {
+    reopen []func() error
+    flush  []func()
+}
+
+// reopenAll opens the files again, after logrotate moved them away.
+func (o *daemonOutputs) reopenAll() {
+    for _, reopen := range o.reopen {
+        if err := reopen(); err != nil {
+            diag.Printf("Error reopening output: %v\n", err)
+        }
+    }
+    diag.Printf("Output files reopened\n")
+}
+
+// flushAll sends what the outputs still hold.
+func (o *daemonOutputs) flushAll() {
+    for _, flush := range o.flush {
+        flush()
+    }
+}
+
+// runDaemon runs without any display until SIGTERM or SIGINT, checking the
+// alerts every cfg.refresh, and returns the exit code. SIGHUP reopens the
+// -log and -export files. With -ascii-plot the graph is written to -log.
+func runDaemon(cfg *config, targets []*target, alertHandlers []alertHandler, outputs *daemonOutputs, running *bool) int {
+    ticker := time.NewTicker(cfg.refresh)
+    defer ticker.Stop()
+    var plots <-chan time.Time
+    if cfg.asciiPlot > 0 {
+        plotTicker := time.NewTicker(cfg.asciiPlot)
+        defer plotTicker.Stop()
+        plots = plotTicker.C
+    }
+
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+    diag.Printf("Running as a daemon, pid %d\n", os.Getpid())
+
+    for *running {
+        select {
+        case sig := <-sigs:
+            if sig == syscall.SIGHUP {
+                outputs.reopenAll()
+                continue
+            }
+            diag.Printf("Received %v, exiting\n", sig)
+            return exitOK
+        case <-plots:
+            diag.Printf("%s\n%s", plotTitle(targets), asciiPlot(cfg, targets))
+        case <-ticker.C:
+            for _, t := range targets {
+                t.mutex.Lock()
+                checkAlerts(t, cfg, alertHandlers)
+                t.mutex.Unlock()
+            }
+        }
+    }
+    // A pinger failed.
+    return exitError
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
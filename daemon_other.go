@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// detach is not implemented on this platform: -daemon stays in the
+// foreground, as it would when run by a service manager.
+func detach() (int, error) {
+    return 0, nil
+}
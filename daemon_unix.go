@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+    "os"
+    "os/exec"
+    "syscall"
+)
+
+// detachedEnv marks the background copy started by detach.
+const detachedEnv = "PINGGRAPH_DETACHED"
+
+// detach starts the program again in a new session, without a terminal
+// and with the standard streams on /dev/null, and returns its pid. It does
+// nothing and returns 0 when there is no terminal to detach from, as under
+// systemd, or in the background copy itself.
+func detach() (int, error) {
+    if os.Getenv(detachedEnv) != "" || !isTerminal(os.Stdin) {
+        return 0, nil
+    }
+    exe, err := os.Executable()
+    if err != nil {
+        return 0, err
+    }
+    null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+    if err != nil {
+        return 0, err
+    }
+    defer null.Close()
+
+    cmd := exec.Command(exe, os.Args[1:]...)
+    cmd.Env = append(os.Environ(), detachedEnv+"=1")
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = null, null, null
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+    if err := cmd.Start(); err != nil {
+        return 0, err
+    }
+    return cmd.Process.Pid, nil
+}
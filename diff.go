@@ -0,0 +1,69 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "time"
+)
+
+// diffSeries returns the RTT of a minus the RTT of b for the last points
+// samples of a, for -diff. Every sample of a is paired with the sample of b
+// sent closest to it; pairs more than tolerance apart or with a lost probe
+// are NaN.
+func diffSeries(a, b *target, points int, deadTimeout float64, tolerance time.Duration) []float64 {
+    aTimes, aStamps := tailSamples(a, points)
+    // A few more of b, so the oldest samples of a find a partner too.
+    bTimes, bStamps := tailSamples(b, points+10)
+
+    diff := make([]float64, len(aTimes))
+    k := 0
+    for i, stamp := range aStamps {
+        diff[i] = math.NaN()
+        for k+1 < len(bStamps) && absDuration(bStamps[k+1].Sub(stamp)) <= absDuration(bStamps[k].Sub(stamp)) {
+            k++
+        }
+        if k >= len(bStamps) || absDuration(bStamps[k].Sub(stamp)) > tolerance {
+            continue
+        }
+        if aTimes[i] != deadTimeout && bTimes[k] != deadTimeout {
+            diff[i] = aTimes[i] - bTimes[k]
+        }
+    }
+    return diff
+}
+
+// tailSamples copies the last n samples of t and when they were sent.
+func tailSamples(t *target, n int) ([]float64, []time.Time) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    start := len(t.times) - n
+    if start < 0 {
+        start = 0
+    }
+    return append([]float64(nil), t.times[start:]...), append([]time.Time(nil), t.stamps[start:]...)
+}
+
+func absDuration(d time.Duration) time.Duration {
+    if d < 0 {
+        return -d
+    }
+    return d
+}
+
+// diffTitle summarizes the -diff series for the plot title: the latest
+// and the average difference, positive when a is slower.
+func diffTitle(a, b *target, diff []float64) string {
+    last := math.NaN()
+    sum, count := 0.0, 0
+    for _, v := range diff {
+        if !math.IsNaN(v) {
+            last = v
+            sum += v
+            count++
+        }
+    }
+    if count == 0 {
+        return fmt.Sprintf("RTT of %s minus %s: no pairs yet", a.name(), b.name())
+    }
+    return fmt.Sprintf("RTT of %s minus %s: now %+.2f ms, avg %+.2f ms", a.name(), b.name(), last, sum/float64(count))
+}
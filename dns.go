@@ -0,0 +1,159 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "net"
+    "time"
+)
+
+// lookup is one timed resolution of a target's host name.
+type lookup struct {
+    Time   time.Time
+    Took   float64 // ms
+    Failed bool
+}
+
+// timedResolve runs resolveHostname and measures how long it took.
+func timedResolve(host string, family addrFamily, preferIPv6 bool) ([]string, bool, time.Duration, error) {
+    start := time.Now()
+    addrs, useIPv6, err := resolveHostname(host, family, preferIPv6)
+    return addrs, useIPv6, time.Since(start), err
+}
+
+// resolveBackoffMax caps the wait between two attempts of -resolve-retries.
+const resolveBackoffMax = 30 * time.Second
+
+// retryResolve runs timedResolve and, while it fails, up to retries more
+// times, waiting 1s, 2s, 4s and so on up to resolveBackoffMax in between,
+// for start scripts that run before DNS works or a name is registered. A
+// host with only addresses of the other family fails right away. at and
+// took are those of the last attempt.
+func retryResolve(host string, family addrFamily, preferIPv6 bool, retries int) (addrs []string, useIPv6 bool, at time.Time, took time.Duration, err error) {
+    wait := time.Second
+    for attempt := 0; ; attempt++ {
+        at = time.Now()
+        addrs, useIPv6, took, err = timedResolve(host, family, preferIPv6)
+        var wrongFamily *familyError
+        if err == nil || attempt >= retries || errors.As(err, &wrongFamily) {
+            return addrs, useIPv6, at, took, err
+        }
+        fmt.Printf("%v, retry %d of %d in %v\n", err, attempt+1, retries, wait)
+        time.Sleep(wait)
+        wait = min(2*wait, resolveBackoffMax)
+    }
+}
+
+// isLiteral reports whether host is an IP address, which needs no DNS.
+func isLiteral(host string) bool {
+    return net.ParseIP(host) != nil
+}
+
+// addLookup records a resolution of the host of t.
+func (t *target) addLookup(at time.Time, took time.Duration, err error) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    t.lookups = append(t.lookups, lookup{Time: at, Took: float64(took) / float64(time.Millisecond), Failed: err != nil})
+}
+
+// resolveLoop resolves the host names of the targets again every interval
+// until ctx is done, to track the DNS resolution time. The targets keep
+// pinging the address they started with; a changed answer is reported.
+func resolveLoop(ctx context.Context, targets []*target, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        for _, t := range targets {
+            if isLiteral(t.host) {
+                continue
+            }
+            family := familyIPv4
+            if t.useIPv6 {
+                family = familyIPv6
+            }
+            start := time.Now()
+            addrs, _, took, err := timedResolve(t.host, family, t.useIPv6)
+            t.addLookup(start, took, err)
+            if err != nil {
+                diag.Printf("Re-resolving %s failed after %v: %v\n", t.host, took.Round(time.Millisecond), err)
+                continue
+            }
+            if !contains(addrs, t.addr) {
+                diag.Printf("DNS for %s no longer returns %s but %v, still pinging %s\n", t.host, t.addr, addrs, t.addr)
+            }
+        }
+    }
+}
+
+func contains(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// dnsStats returns the latest and the average resolution time and the
+// number of lookups and failed ones. The times are NaN without any
+// successful lookup. t.mutex must be held.
+func dnsStats(t *target) (last, avg float64, n, failed int) {
+    last, avg = math.NaN(), math.NaN()
+    sum := 0.0
+    ok := 0
+    for _, l := range t.lookups {
+        if l.Failed {
+            failed++
+            continue
+        }
+        last = l.Took
+        sum += l.Took
+        ok++
+    }
+    if ok > 0 {
+        avg = sum / float64(ok)
+    }
+    return last, avg, len(t.lookups), failed
+}
+
+// formatDNS formats the resolution times for the stats panel.
+func formatDNS(st Stats) string {
+    if st.DNSLookups == 0 {
+        return "not used"
+    }
+    text := "-"
+    if !math.IsNaN(st.DNSLast) {
+        text = fmt.Sprintf("%.1f ms now, %.1f ms avg", st.DNSLast, st.DNSAvg)
+    }
+    text += fmt.Sprintf(" (%d lookups", st.DNSLookups)
+    if st.DNSFailed > 0 {
+        return text + fmt.Sprintf(", [%d failed](fg:red))", st.DNSFailed)
+    }
+    return text + ")"
+}
+
+// dnsSeries returns the resolution time in effect when each probe was sent,
+// for plotting DNS next to the ping RTT: the latest successful lookup
+// before the probe, NaN before the first one. t.mutex must be held.
+func dnsSeries(t *target, stamps []time.Time) []float64 {
+    series := make([]float64, len(stamps))
+    j := -1
+    current := math.NaN()
+    for i, stamp := range stamps {
+        for j+1 < len(t.lookups) && !t.lookups[j+1].Time.After(stamp) {
+            j++
+            if !t.lookups[j].Failed {
+                current = t.lookups[j].Took
+            }
+        }
+        series[i] = current
+    }
+    return series
+}
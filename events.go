@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+)
+
+// maxLossEvents is the number of loss events kept per target, older ones
+// are dropped.
+const maxLossEvents = 200
+
+// lossEvent is a run of consecutive lost probes.
+type lossEvent struct {
+    Start time.Time // when the first lost probe was sent
+    Last  time.Time // when the last lost probe was sent
+    End   time.Time // when the first probe answered again was sent, zero while ongoing
+    Lost  int
+}
+
+// duration returns how long the target was unreachable: until the next
+// reply for a finished event, until the latest lost probe otherwise.
+func (e lossEvent) duration() time.Duration {
+    if e.End.IsZero() {
+        return e.Last.Sub(e.Start)
+    }
+    return e.End.Sub(e.Start)
+}
+
+// addLoss extends the ongoing loss event or starts a new one. Called with
+// mutex held.
+func (t *target) addLoss(at time.Time) {
+    if n := len(t.lossEvents); n > 0 && t.lossEvents[n-1].End.IsZero() {
+        t.lossEvents[n-1].Last = at
+        t.lossEvents[n-1].Lost++
+        return
+    }
+    t.lossEvents = append(t.lossEvents, lossEvent{Start: at, Last: at, Lost: 1})
+    if len(t.lossEvents) > maxLossEvents {
+        t.lossEvents = t.lossEvents[len(t.lossEvents)-maxLossEvents:]
+    }
+}
+
+// endLoss finishes the ongoing loss event, if any, with the reply to the
+// probe sent at at. Called with mutex held.
+func (t *target) endLoss(at time.Time) {
+    if n := len(t.lossEvents); n > 0 && t.lossEvents[n-1].End.IsZero() {
+        t.lossEvents[n-1].End = at
+    }
+}
+
+// lossEventRows renders the loss events and status changes of all
+// targets and the notes, oldest first, as rows of the events list, e.g.
+// "14:32:05 — 3 lost, 1.5s" or "14:32:07 — DOWN, was UP". With several
+// targets every row starts with the target address in its plot color.
+func lossEventRows(targets []*target, notes []note) []string {
+    type row struct {
+        start time.Time
+        text  string
+    }
+    var rows []row
+    for _, t := range targets {
+        prefix := ""
+        if len(targets) > 1 {
+            prefix = fmt.Sprintf("[%s](fg:%s) ", t.addr, t.colorName())
+        }
+        t.mutex.Lock()
+        for _, e := range t.lossEvents {
+            ongoing := ""
+            if e.End.IsZero() {
+                ongoing = " (ongoing)"
+            }
+            rows = append(rows, row{e.Start, fmt.Sprintf("%s%s — %d lost, %.1fs%s",
+                prefix, e.Start.Format("15:04:05"), e.Lost, e.duration().Seconds(), ongoing)})
+        }
+        t.mutex.Unlock()
+        if t.status != nil {
+            for _, c := range t.status.history() {
+                rows = append(rows, row{c.At, fmt.Sprintf("%s%s — [%s](fg:%s), was %s",
+                    prefix, c.At.Format("15:04:05"), c.To, c.To.color(), c.From)})
+            }
+        }
+    }
+    for _, n := range notes {
+        // Brackets in the text would end the markup.
+        text := strings.NewReplacer("[", "(", "]", ")").Replace(n.Text)
+        rows = append(rows, row{n.Time, fmt.Sprintf("%s — [note: %s](mod:bold)", n.Time.Format("15:04:05"), text)})
+    }
+    sort.SliceStable(rows, func(i, j int) bool {
+        return rows[i].start.Before(rows[j].start)
+    })
+    texts := make([]string, len(rows))
+    for i, r := range rows {
+        texts[i] = r.text
+    }
+    return texts
+}
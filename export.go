@@ -0,0 +1,216 @@
+package main
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// exportRecord is one sample as stored in an export file.
+type exportRecord struct {
+    Time   time.Time `json:"time"`
+    Host   string    `json:"host"`
+    Addr   string    `json:"addr"`
+    Seq    int       `json:"seq"`
+    RTT    *float64  `json:"rtt_ms"` // nil for lost probes
+    Status string    `json:"status"`
+    Note   string    `json:"note,omitempty"`
+}
+
+var exportHeader = []string{"time", "host", "addr", "seq", "rtt_ms", "status", "note"}
+
+// exportSampleFields are the fields of the files written before notes were
+// exported, which are still read.
+const exportSampleFields = 6
+
+// exportNoteStatus is the status of the records holding a note instead of
+// a sample. They have no host and no seq.
+const exportNoteStatus = "note"
+
+// exportIsJSON reports whether path selects the JSON lines format, otherwise
+// CSV is used.
+func exportIsJSON(path string) bool {
+    ext := strings.ToLower(filepath.Ext(path))
+    return ext == ".json" || ext == ".jsonl"
+}
+
+// exportWriter appends every sample to a CSV or JSON lines file. Each record
+// is flushed right away so the file is complete even when the program is
+// killed.
+type exportWriter struct {
+    path  string
+    mutex sync.Mutex
+    file  *os.File
+    csv   *csv.Writer
+    json  *json.Encoder
+}
+
+func newExportWriter(path string) (*exportWriter, error) {
+    file, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    w := &exportWriter{path: path, file: file}
+    if exportIsJSON(path) {
+        w.json = json.NewEncoder(file)
+        return w, nil
+    }
+    w.csv = csv.NewWriter(file)
+    w.csv.Write(exportHeader)
+    w.csv.Flush()
+    return w, w.csv.Error()
+}
+
+func (w *exportWriter) observe(t *target, s sample) {
+    record := exportRecord{
+        Time:   s.Time,
+        Host:   t.host,
+        Addr:   t.addr,
+        Seq:    s.Seq,
+        Status: s.Status,
+    }
+    if !s.Lost {
+        rtt := s.RTT
+        record.RTT = &rtt
+    }
+
+    w.write(record)
+}
+
+// note writes a note record.
+func (w *exportWriter) note(n note) {
+    w.write(exportRecord{Time: n.Time, Status: exportNoteStatus, Note: n.Text})
+}
+
+func (w *exportWriter) write(record exportRecord) {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if w.json != nil {
+        w.json.Encode(record)
+        return
+    }
+    rtt := ""
+    if record.RTT != nil {
+        rtt = strconv.FormatFloat(*record.RTT, 'f', -1, 64)
+    }
+    w.csv.Write([]string{
+        record.Time.Format(time.RFC3339Nano),
+        record.Host,
+        record.Addr,
+        strconv.Itoa(record.Seq),
+        rtt,
+        record.Status,
+        record.Note,
+    })
+    w.csv.Flush()
+}
+
+// reopen continues in a new file at the path, e.g. after logrotate moved
+// the file away. An existing file is appended to.
+func (w *exportWriter) reopen() error {
+    file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return err
+    }
+
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    old := w.file
+    w.file = file
+    if w.json != nil {
+        w.json = json.NewEncoder(file)
+    } else {
+        w.csv = csv.NewWriter(file)
+        if info.Size() == 0 {
+            w.csv.Write(exportHeader)
+            w.csv.Flush()
+        }
+    }
+    return old.Close()
+}
+
+// readExport loads all records of a file written by exportWriter.
+func readExport(path string) ([]exportRecord, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    if exportIsJSON(path) {
+        return readExportJSON(file)
+    }
+    return readExportCSV(file)
+}
+
+func readExportJSON(r io.Reader) ([]exportRecord, error) {
+    var records []exportRecord
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for line := 1; scanner.Scan(); line++ {
+        if strings.TrimSpace(scanner.Text()) == "" {
+            continue
+        }
+        var record exportRecord
+        if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+            return nil, fmt.Errorf("line %d: %v", line, err)
+        }
+        records = append(records, record)
+    }
+    return records, scanner.Err()
+}
+
+func readExportCSV(r io.Reader) ([]exportRecord, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    rows, err := reader.ReadAll()
+    if err != nil {
+        return nil, err
+    }
+    if len(rows) == 0 || (strings.Join(rows[0], ",") != strings.Join(exportHeader, ",") &&
+        strings.Join(rows[0], ",") != strings.Join(exportHeader[:exportSampleFields], ",")) {
+        return nil, fmt.Errorf("missing header %q", strings.Join(exportHeader, ","))
+    }
+    fields := len(rows[0])
+
+    records := make([]exportRecord, 0, len(rows)-1)
+    for i, row := range rows[1:] {
+        if len(row) < fields {
+            return nil, fmt.Errorf("line %d: expected %d fields, got %d", i+2, fields, len(row))
+        }
+        at, err := time.Parse(time.RFC3339Nano, row[0])
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %v", i+2, err)
+        }
+        seq, err := strconv.Atoi(row[3])
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %v", i+2, err)
+        }
+        record := exportRecord{Time: at, Host: row[1], Addr: row[2], Seq: seq, Status: row[5]}
+        if fields > exportSampleFields {
+            record.Note = row[6]
+        }
+        if row[4] != "" {
+            rtt, err := strconv.ParseFloat(row[4], 64)
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %v", i+2, err)
+            }
+            record.RTT = &rtt
+        }
+        records = append(records, record)
+    }
+    return records, nil
+}
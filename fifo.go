@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "os"
+    "time"
+)
+
+// fifoTarget is the -fifo snapshot of one target. RTTs are in ms.
+type fifoTarget struct {
+    Host     string   `json:"host"`
+    Addr     string   `json:"addr"`
+    State    string   `json:"state"`
+    Sent     int      `json:"sent"`
+    Received int      `json:"received"`
+    Lost     int      `json:"lost"`
+    LossPct  float64  `json:"loss_pct"`
+    Last     *float64 `json:"last_ms"` // nil if lost or nothing sent yet
+    Avg      float64  `json:"avg_ms"`
+    Min      float64  `json:"min_ms"`
+    Max      float64  `json:"max_ms"`
+    P50      float64  `json:"p50_ms"`
+    P99      float64  `json:"p99_ms"`
+    Jitter   float64  `json:"jitter_ms"`
+    CV       *float64 `json:"cv_pct"` // nil without replies
+}
+
+// fifoSnapshot is one line written to the -fifo.
+type fifoSnapshot struct {
+    Time    time.Time    `json:"time"`
+    Targets []fifoTarget `json:"targets"`
+}
+
+// runFIFO writes the stats of the targets as a JSON line to the FIFO at
+// path every cfg.refresh until ctx is done. Without a reader the line is
+// dropped, so nothing waits for one; a reader that goes away is replaced
+// by the next one that opens the FIFO.
+func runFIFO(ctx context.Context, path string, cfg *config, targets []*target, startTime time.Time) {
+    ticker := time.NewTicker(cfg.refresh)
+    defer ticker.Stop()
+    var fifo *os.File
+    defer func() {
+        if fifo != nil {
+            fifo.Close()
+        }
+    }()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        if fifo == nil {
+            var err error
+            if fifo, err = openFIFO(path); err != nil {
+                if !errors.Is(err, errNoReader) {
+                    diag.Printf("Error opening -fifo %s: %v\n", path, err)
+                }
+                continue
+            }
+        }
+        line, err := json.Marshal(takeFIFOSnapshot(cfg, targets, startTime))
+        if err != nil {
+            diag.Printf("Error encoding -fifo stats: %v\n", err)
+            continue
+        }
+        // A reader that stopped reading must not hold up the next lines.
+        fifo.SetWriteDeadline(time.Now().Add(cfg.refresh))
+        if _, err := fifo.Write(append(line, '\n')); err != nil {
+            // Broken pipe, the reader went away.
+            fifo.Close()
+            fifo = nil
+        }
+    }
+}
+
+func takeFIFOSnapshot(cfg *config, targets []*target, startTime time.Time) fifoSnapshot {
+    snap := fifoSnapshot{Time: time.Now()}
+    for _, t := range targets {
+        t.mutex.Lock()
+        st := computeStats(t, cfg, startTime)
+        t.mutex.Unlock()
+        ft := fifoTarget{
+            Host:     t.host,
+            Addr:     t.addr,
+            State:    st.State.String(),
+            Sent:     st.Total,
+            Received: st.Total - st.NLost,
+            Lost:     st.NLost,
+            LossPct:  st.PctLost,
+            Avg:      st.Avg,
+            Min:      st.Min,
+            Max:      st.Max,
+            P50:      st.P50,
+            P99:      st.P99,
+            Jitter:   st.Jitter,
+        }
+        if cv, ok := st.cv(); ok {
+            ft.CV = &cv
+        }
+        if st.Total > 0 && st.Last != cfg.deadTimeout {
+            last := st.Last
+            ft.Last = &last
+        }
+        snap.Targets = append(snap.Targets, ft)
+    }
+    return snap
+}
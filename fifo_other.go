@@ -0,0 +1,19 @@
+//go:build !unix
+
+package main
+
+import (
+    "errors"
+    "os"
+)
+
+var errNoReader = errors.New("no reader")
+
+// createFIFO is not implemented on this platform, which has no FIFOs.
+func createFIFO(path string) error {
+    return errors.New("-fifo is only supported on Linux, macOS and other Unix systems")
+}
+
+func openFIFO(path string) (*os.File, error) {
+    return nil, errNoReader
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "syscall"
+)
+
+// errNoReader is returned by openFIFO while no process has the FIFO open
+// for reading.
+var errNoReader = errors.New("no reader")
+
+// createFIFO makes a FIFO at path unless there is one already.
+func createFIFO(path string) error {
+    info, err := os.Stat(path)
+    if err == nil {
+        if info.Mode()&os.ModeNamedPipe == 0 {
+            return fmt.Errorf("%s exists and is not a FIFO", path)
+        }
+        return nil
+    }
+    if !os.IsNotExist(err) {
+        return err
+    }
+    return syscall.Mkfifo(path, 0644)
+}
+
+// openFIFO opens the FIFO for writing without waiting for a reader.
+func openFIFO(path string) (*os.File, error) {
+    fifo, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+    if errors.Is(err, syscall.ENXIO) {
+        return nil, errNoReader
+    }
+    return fifo, err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+)
+
+const (
+    // heAttemptDelay is the head start a happy eyeballs client gives IPv6
+    // before it tries IPv4 as well, the Connection Attempt Delay of RFC 8305
+    // in ms.
+    heAttemptDelay = 250
+    // racePending is how many probe numbers a round may wait for the reply
+    // of the other family before it is dropped.
+    racePending = 1000
+)
+
+// race compares the IPv4 and IPv6 address of a host with -happy-eyeballs.
+// Both targets send probe n at the same time, so the two results of probe
+// n form a round, which the faster family wins. A round is counted once
+// both results are in.
+type race struct {
+    v4, v6 *target
+    warmup int
+
+    mutex   sync.Mutex
+    pending map[int]raceResult // first result of a round, by probe number
+    latest  int
+    summary raceSummary
+}
+
+// raceResult is a result waiting for the other family.
+type raceResult struct {
+    sample
+    ipv6 bool
+}
+
+// raceSummary counts the rounds of a race.
+type raceSummary struct {
+    Rounds   int
+    V4Faster int // including rounds only IPv4 answered
+    V6Faster int
+    Ties     int
+    BothLost int
+    HEv4     int // rounds a happy eyeballs client would have used IPv4
+    HEv6     int
+}
+
+func newRace(v4, v6 *target, warmup int) *race {
+    r := &race{v4: v4, v6: v6, warmup: warmup, pending: make(map[int]raceResult)}
+    v4.race = r
+    v6.race = r
+    return r
+}
+
+// observe is the sample observer of both targets.
+func (r *race) observe(t *target, s sample) {
+    if s.Seq <= r.warmup {
+        return
+    }
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    if s.Seq > r.latest {
+        r.latest = s.Seq
+        for seq := range r.pending {
+            if seq < r.latest-racePending {
+                delete(r.pending, seq)
+            }
+        }
+    }
+    other, ok := r.pending[s.Seq]
+    if !ok || other.ipv6 == (t == r.v6) {
+        r.pending[s.Seq] = raceResult{s, t == r.v6}
+        return
+    }
+    delete(r.pending, s.Seq)
+    if other.ipv6 {
+        r.summary.add(s, other.sample)
+    } else {
+        r.summary.add(other.sample, s)
+    }
+}
+
+// add counts one round.
+func (rs *raceSummary) add(v4, v6 sample) {
+    rs.Rounds++
+    switch {
+    case v4.Lost && v6.Lost:
+        rs.BothLost++
+        return
+    case v6.Lost || (!v4.Lost && v4.RTT < v6.RTT):
+        rs.V4Faster++
+    case v4.Lost || v6.RTT < v4.RTT:
+        rs.V6Faster++
+    default:
+        rs.Ties++
+    }
+    // The client tries IPv6 first and only falls back to IPv4 when IPv6 is
+    // not through before IPv4, started heAttemptDelay later, is.
+    if !v6.Lost && (v4.Lost || v6.RTT <= v4.RTT+heAttemptDelay) {
+        rs.HEv6++
+    } else {
+        rs.HEv4++
+    }
+}
+
+// stats returns the current counts.
+func (r *race) stats() raceSummary {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    return r.summary
+}
+
+// reset starts the comparison over.
+func (r *race) reset() {
+    r.mutex.Lock()
+    defer r.mutex.Unlock()
+    r.pending = make(map[int]raceResult)
+    r.summary = raceSummary{}
+}
+
+// formatRace renders the race summary, e.g.
+//
+//    IPv4 vs IPv6: 120 rounds, faster v4 55% / v6 40% / tie 5%
+//    Happy eyeballs uses v6 98%, prefer IPv4
+func formatRace(rs raceSummary) string {
+    if rs.Rounds == 0 {
+        return "IPv4 vs IPv6: no rounds yet\n"
+    }
+    pct := func(n int) float64 {
+        return float64(n) / float64(rs.Rounds) * 100
+    }
+    text := fmt.Sprintf("IPv4 vs IPv6: %d rounds, faster v4 %.0f%% / v6 %.0f%% / tie %.0f%%",
+        rs.Rounds, pct(rs.V4Faster), pct(rs.V6Faster), pct(rs.Ties))
+    if rs.BothLost > 0 {
+        text += fmt.Sprintf(" / both lost %.0f%%", pct(rs.BothLost))
+    }
+    verdict := "no preference"
+    switch {
+    case rs.V4Faster > rs.V6Faster:
+        verdict = "prefer IPv4"
+    case rs.V6Faster > rs.V4Faster:
+        verdict = "prefer IPv6"
+    }
+    return text + fmt.Sprintf("\nHappy eyeballs uses v6 %.0f%%, %s\n", pct(rs.HEv6), verdict)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+    "errors"
+    "os"
+)
+
+// listenErrorHint explains a failure to open the ICMP socket.
+func listenErrorHint(err error) string {
+    if errors.Is(err, os.ErrPermission) {
+        return "Raw ICMP sockets require root privileges or the CAP_NET_RAW capability " +
+            "(e.g. sudo setcap cap_net_raw+ep ./pingGraphGo)."
+    }
+    return ""
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+// listenErrorHint explains a failure to open the ICMP socket. Windows only
+// hands out raw ICMP sockets to elevated processes, and the resulting error
+// does not say so.
+func listenErrorHint(err error) string {
+    return "Raw ICMP sockets on Windows require Administrator rights: run the terminal as Administrator " +
+        "and make sure Windows Defender Firewall allows inbound ICMP echo replies."
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+const (
+    // influxBatchSize is the number of lines after which a batch is sent
+    // without waiting for the flush interval.
+    influxBatchSize = 500
+    // influxUDPPayload keeps UDP datagrams below a typical path MTU.
+    influxUDPPayload = 1400
+)
+
+// influxWriter streams samples as InfluxDB line protocol to a UDP listener
+// or an HTTP write endpoint. Samples are queued by observe and sent in
+// batches by run, so a slow or unreachable database never blocks pinging;
+// when the queue is full new lines are dropped.
+type influxWriter struct {
+    endpoint *url.URL
+    interval time.Duration
+    lines    chan string
+    flushReq chan chan struct{}
+    client   *http.Client
+}
+
+// newInfluxWriter validates the -influx URL. Supported forms are
+// udp://host:port and http(s)://host:port/write?db=name (or any other
+// write URL accepting line protocol in a POST body).
+func newInfluxWriter(rawURL string, interval time.Duration) (*influxWriter, error) {
+    endpoint, err := url.Parse(rawURL)
+    if err != nil {
+        return nil, err
+    }
+    switch endpoint.Scheme {
+    case "udp", "http", "https":
+    default:
+        return nil, fmt.Errorf("unsupported InfluxDB URL scheme %q (want udp, http or https)", endpoint.Scheme)
+    }
+    if endpoint.Host == "" {
+        return nil, fmt.Errorf("InfluxDB URL %q has no host", rawURL)
+    }
+    return &influxWriter{
+        endpoint: endpoint,
+        interval: interval,
+        lines:    make(chan string, influxBatchSize*4),
+        flushReq: make(chan chan struct{}),
+        client:   &http.Client{Timeout: 10 * time.Second},
+    }, nil
+}
+
+func (w *influxWriter) observe(t *target, s sample) {
+    line := influxLine(t, s)
+    select {
+    case w.lines <- line:
+    default:
+    }
+}
+
+// influxLine formats a single sample as a line protocol point.
+func influxLine(t *target, s sample) string {
+    tags := fmt.Sprintf("ping,host=%s,addr=%s", influxEscape(t.host), influxEscape(t.addr))
+    if s.Lost {
+        return fmt.Sprintf("%s lost=1i,seq=%di %d", tags, s.Seq, s.Time.UnixNano())
+    }
+    return fmt.Sprintf("%s rtt=%g,lost=0i,seq=%di %d", tags, s.RTT, s.Seq, s.Time.UnixNano())
+}
+
+// influxEscape escapes the characters that are special in tag values.
+func influxEscape(value string) string {
+    return strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `).Replace(value)
+}
+
+// run collects queued lines and flushes them every interval or whenever a
+// full batch is ready. Failed batches are reported and discarded.
+func (w *influxWriter) run() {
+    ticker := time.NewTicker(w.interval)
+    defer ticker.Stop()
+
+    var batch []string
+    flush := func() {
+        if len(batch) == 0 {
+            return
+        }
+        if err := w.send(batch); err != nil {
+            diag.Printf("Error writing to InfluxDB: %v\n", err)
+        }
+        batch = batch[:0]
+    }
+
+    for {
+        select {
+        case line := <-w.lines:
+            batch = append(batch, line)
+            if len(batch) >= influxBatchSize {
+                flush()
+            }
+        case <-ticker.C:
+            flush()
+        case done := <-w.flushReq:
+            for len(w.lines) > 0 {
+                batch = append(batch, <-w.lines)
+                if len(batch) >= influxBatchSize {
+                    flush()
+                }
+            }
+            flush()
+            close(done)
+        }
+    }
+}
+
+// flush sends the queued lines right away and waits until they are sent.
+func (w *influxWriter) flush() {
+    done := make(chan struct{})
+    w.flushReq <- done
+    <-done
+}
+
+func (w *influxWriter) send(batch []string) error {
+    if w.endpoint.Scheme == "udp" {
+        return w.sendUDP(batch)
+    }
+    return w.sendHTTP(batch)
+}
+
+func (w *influxWriter) sendUDP(batch []string) error {
+    conn, err := net.Dial("udp", w.endpoint.Host)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+
+    var packet bytes.Buffer
+    for _, line := range batch {
+        if packet.Len() > 0 && packet.Len()+len(line)+1 > influxUDPPayload {
+            if _, err := conn.Write(packet.Bytes()); err != nil {
+                return err
+            }
+            packet.Reset()
+        }
+        packet.WriteString(line)
+        packet.WriteByte('\n')
+    }
+    _, err = conn.Write(packet.Bytes())
+    return err
+}
+
+func (w *influxWriter) sendHTTP(batch []string) error {
+    body := strings.Join(batch, "\n") + "\n"
+    resp, err := w.client.Post(w.endpoint.String(), "text/plain; charset=utf-8", strings.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("InfluxDB write returned %s", resp.Status)
+    }
+    return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+)
+
+// diagLogger receives the per-probe diagnostics ("Ping to X timed out",
+// output errors, ...). They must not reach the terminal while termui owns
+// the screen, so the graph and status line modes mute the terminal output
+// unless -verbose is given. With -log they are written to a file as well,
+// with a timestamp, in every mode.
+type diagLogger struct {
+    mutex sync.Mutex
+    out   io.Writer // terminal output, nil when muted
+    file  io.Writer // -log file, nil if not given
+}
+
+// diag is the logger used throughout the program.
+var diag = &diagLogger{out: os.Stdout}
+
+func (l *diagLogger) Printf(format string, args ...interface{}) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    if l.out != nil {
+        fmt.Fprintf(l.out, format, args...)
+    }
+    if l.file != nil {
+        io.WriteString(l.file, time.Now().Format("2006-01-02T15:04:05.000 "))
+        fmt.Fprintf(l.file, format, args...)
+    }
+}
+
+// mute stops or resumes the terminal output.
+func (l *diagLogger) mute(muted bool) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    l.out = os.Stdout
+    if muted {
+        l.out = nil
+    }
+}
+
+// reopenFile continues the -log output in the file at path, appending to
+// it, and closes the previous file.
+func (l *diagLogger) reopenFile(path string) error {
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        return err
+    }
+    l.mutex.Lock()
+    old := l.file
+    l.file = file
+    l.mutex.Unlock()
+    if closer, ok := old.(io.Closer); ok {
+        return closer.Close()
+    }
+    return nil
+}
+
+// setFile additionally writes all diagnostics to w.
+func (l *diagLogger) setFile(w io.Writer) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    l.file = w
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+    "math"
+    "sort"
+    "time"
+)
+
+const (
+    // lowPowerRefresh is the display refresh of -low-power while nothing
+    // unusual happens.
+    lowPowerRefresh = 10 * time.Second
+    // lowPowerHold is how long the display keeps the -refresh rate after a
+    // loss or a slow reply.
+    lowPowerHold = 30 * time.Second
+    // lowPowerPercentiles is how often -low-power sorts the replies again
+    // for the percentiles and scans the recent samples for the trend, the
+    // moving average and the period, the numbers not kept incrementally.
+    lowPowerPercentiles = 30 * time.Second
+)
+
+// runningStats keeps the sample numbers of Stats up to date as samples are
+// recorded, so -low-power does not go over the whole history on every
+// refresh. The fields follow scanStats: warmup samples are left out and a
+// sample equal to the -D value counts as lost.
+type runningStats struct {
+    deadTimeout float64
+    slowRTT     float64
+    warmup      int
+    breakGaps   bool // -jitter-gaps break
+
+    total, valid, lost int
+    slow               int // replies slower than -slow
+    atTimeout          int // replies at or above -slow, and losses
+    run, maxRun        int // consecutive atTimeout samples
+    up                 uptime
+    min, max           float64
+    mean, m2           float64 // Welford's running mean and squared deviations
+    previous           float64 // last reply for the jitter, NaN after a break
+    sumDiffs           float64
+    pairs              int
+    nWarmup            int
+
+    // replies are kept for the percentiles, which are refreshed every
+    // lowPowerPercentiles only.
+    replies          []float64
+    p50, p95, p99    float64
+    percentilesAt    time.Time
+    percentilesValid int
+
+    // The numbers computed from the recent samples, refreshed every
+    // lowPowerPercentiles as well.
+    trend     int
+    ma        float64
+    period    periodHint
+    derivedAt time.Time
+}
+
+func newRunningStats(cfg *config) *runningStats {
+    return &runningStats{
+        deadTimeout: cfg.deadTimeout,
+        slowRTT:     float64(cfg.slowRTT),
+        warmup:      cfg.warmup,
+        breakGaps:   cfg.jitterGaps == "break",
+        previous:    math.NaN(),
+        up:          uptime{tolerance: cfg.lossTol},
+    }
+}
+
+// reset drops everything but the settings.
+func (r *runningStats) reset() {
+    *r = runningStats{
+        deadTimeout: r.deadTimeout,
+        slowRTT:     r.slowRTT,
+        warmup:      r.warmup,
+        breakGaps:   r.breakGaps,
+        previous:    math.NaN(),
+        up:          uptime{tolerance: r.up.tolerance},
+    }
+}
+
+// add accounts for one recorded sample. t.mutex must be held.
+func (r *runningStats) add(seq int, v float64) {
+    if seq <= r.warmup {
+        r.nWarmup++
+        return
+    }
+    r.total++
+    r.up.add(v == r.deadTimeout)
+    if v == r.deadTimeout {
+        r.lost++
+        r.atTimeout++
+        r.run++
+        if r.breakGaps {
+            r.previous = math.NaN()
+        }
+    } else {
+        if v > r.slowRTT {
+            r.slow++
+        }
+        if v >= r.slowRTT {
+            r.atTimeout++
+            r.run++
+        } else {
+            r.run = 0
+        }
+
+        r.valid++
+        if r.valid == 1 || v < r.min {
+            r.min = v
+        }
+        if r.valid == 1 || v > r.max {
+            r.max = v
+        }
+        delta := v - r.mean
+        r.mean += delta / float64(r.valid)
+        r.m2 += delta * (v - r.mean)
+
+        if !math.IsNaN(r.previous) {
+            r.sumDiffs += math.Abs(v - r.previous)
+            r.pairs++
+        }
+        r.previous = v
+        r.replies = append(r.replies, v)
+    }
+    if r.run > r.maxRun {
+        r.maxRun = r.run
+    }
+}
+
+// fill copies the running numbers into st. t.mutex must be held.
+func (r *runningStats) fill(st *Stats) {
+    st.Total = r.total
+    st.Valid = r.valid
+    st.NWarmup = r.nWarmup
+    st.NLost = r.lost
+    st.NTimeout = r.atTimeout
+    st.MaxSeqTimeout = r.maxRun
+    st.Uptime, st.MaxUptime = r.up.run, r.up.max
+    if r.total > 0 {
+        st.PctTimeout = float64(r.slow) / float64(r.total) * 100
+        st.PctLost = float64(r.lost) / float64(r.total) * 100
+    }
+    if r.valid == 0 {
+        return
+    }
+    st.Avg = r.mean
+    st.Min = r.min
+    st.Max = r.max
+    st.StdDev = math.Sqrt(r.m2 / float64(r.valid))
+    if r.valid >= 2 {
+        st.StdErr = math.Sqrt(r.m2/float64(r.valid-1)) / math.Sqrt(float64(r.valid))
+        st.CI95 = tCritical95(r.valid-1) * st.StdErr
+    }
+    if r.pairs > 0 {
+        st.Jitter = r.sumDiffs / float64(r.pairs)
+    }
+
+    if r.valid != r.percentilesValid && time.Since(r.percentilesAt) >= lowPowerPercentiles {
+        sorted := append([]float64(nil), r.replies...)
+        sort.Float64s(sorted)
+        r.p50 = percentile(sorted, 50)
+        r.p95 = percentile(sorted, 95)
+        r.p99 = percentile(sorted, 99)
+        r.percentilesAt = time.Now()
+        r.percentilesValid = r.valid
+    }
+    st.P50, st.P95, st.P99 = r.p50, r.p95, r.p99
+}
+
+// fillDerived sets the trend, moving average and period of st, computed
+// from the recent samples of t at most every lowPowerPercentiles.
+// t.mutex must be held.
+func (r *runningStats) fillDerived(t *target, cfg *config, st *Stats) {
+    if r.derivedAt.IsZero() || time.Since(r.derivedAt) >= lowPowerPercentiles {
+        r.trend = latencyTrend(t, cfg.deadTimeout, cfg.trendWindow, time.Now())
+        r.ma = movingAverage(t, cfg.deadTimeout, cfg.warmup, cfg.movingAvg)
+        r.period = latencyPeriod(t, cfg.deadTimeout)
+        r.derivedAt = time.Now()
+    }
+    st.Trend, st.MA, st.Period = r.trend, r.ma, r.period
+}
+
+// anomalyWaker returns a sample observer that signals wake on every loss or
+// reply slower than -slow, for -low-power to return to the -refresh rate.
+func anomalyWaker(cfg *config, wake chan<- struct{}) sampleObserver {
+    return func(t *target, s sample) {
+        if !s.Lost && s.RTT <= float64(cfg.slowRTT) {
+            return
+        }
+        select {
+        case wake <- struct{}{}:
+        default:
+        }
+    }
+}
@@ -1,438 +1,1036 @@
 package main
 
 import (
+    "context"
+    "crypto/rand"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
     "flag"
     "fmt"
-    "math"
     "net"
     "os"
-    "os/signal"
-    "runtime"
+    "strings"
     "sync"
-    "syscall"
     "time"
 
-    termui "github.com/gizak/termui/v3"
-    "github.com/gizak/termui/v3/widgets"
-    "golang.org/x/net/icmp"
-    "golang.org/x/net/ipv4"
-    "golang.org/x/net/ipv6"
+    "ping_graph_go/pinger"
 )
 
 func main() {
     // Parse command-line arguments
-    var (
-        timeout     = flag.Int("W", 150, "Timeout in milliseconds for each ping request")
-        interval    = flag.Float64("i", 0.1, "Interval between pings in seconds")
-        deadTimeout = flag.Float64("D", 500, "Execution timeout in milliseconds for each ping command (max 10000 ms)")
-        useIPv6     = flag.Bool("6", false, "Use IPv6 for the ping")
-    )
-    flag.Parse()
-
-    if len(flag.Args()) < 1 {
-        fmt.Println("Usage: go run main.go [options] host")
+    cfg := parseFlags()
+
+    if len(flag.Args()) < 1 && cfg.replayFile == "" && cfg.analyze == "" {
+        fmt.Println("Usage: go run . [options] host [host...]")
         flag.PrintDefaults()
         os.Exit(1)
     }
-    host := flag.Args()[0]
 
-    if *deadTimeout > 10000 || *deadTimeout < float64(*timeout) {
-        fmt.Printf("Dead timeout (-D) value %v out of range. Exiting.\n", *deadTimeout)
+    if cfg.interval < minInterval.Seconds() {
+        fmt.Printf("Interval (-i) value %v is below the minimum of %v. Exiting.\n", time.Duration(cfg.interval*float64(time.Second)), minInterval)
+        os.Exit(1)
+    }
+    if cfg.timeout < 1 {
+        fmt.Printf("Timeout (-W) value %d ms must be at least 1 ms. Exiting.\n", cfg.timeout)
+        os.Exit(1)
+    }
+
+    if cfg.deadTimeout > 10000 || cfg.deadTimeout < float64(cfg.timeout) {
+        fmt.Printf("Dead timeout (-D) value %v out of range. Exiting.\n", cfg.deadTimeout)
+        os.Exit(1)
+    }
+
+    if cfg.slowRTT < 0 || cfg.slowRTT > cfg.timeout {
+        fmt.Printf("Slow threshold (-slow) value %d must be between 0 and the -W timeout %d. Exiting.\n", cfg.slowRTT, cfg.timeout)
+        os.Exit(1)
+    }
+    if cfg.slowRTT == 0 {
+        cfg.slowRTT = cfg.timeout
+    }
+    if cfg.lossTol < 0 {
+        fmt.Printf("Loss tolerance (-loss-tolerance) value %d must not be negative. Exiting.\n", cfg.lossTol)
+        os.Exit(1)
+    }
+    if cfg.hysteresis < 1 {
+        fmt.Printf("Status hysteresis (-hysteresis) value %d must be at least 1. Exiting.\n", cfg.hysteresis)
+        os.Exit(1)
+    }
+
+    if cfg.payloadSize < 0 || cfg.payloadSize > pinger.MaxPayloadSize {
+        fmt.Printf("Payload size (-s) value %d out of range (0-%d). Exiting.\n", cfg.payloadSize, pinger.MaxPayloadSize)
+        os.Exit(1)
+    }
+
+    if cfg.bufSize == 0 {
+        cfg.bufSize = pinger.DefaultBufSize(cfg.payloadSize)
+    } else if cfg.bufSize < pinger.ICMPHeaderSize {
+        fmt.Printf("Read buffer size (-bufsize) value %d too small. Exiting.\n", cfg.bufSize)
+        os.Exit(1)
+    }
+
+    if cfg.pattern != "" {
+        schedule, err := parsePattern(cfg.pattern)
+        if err != nil {
+            fmt.Printf("Invalid -pattern value: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        cfg.schedule = schedule
+        // The stats expect probes at -i, on average they come this often.
+        cfg.interval = patternPeriod(schedule).Seconds()
+    }
+
+    if cfg.refresh <= 0 {
+        fmt.Printf("Refresh interval (-refresh) value %v must be positive. Exiting.\n", cfg.refresh)
+        os.Exit(1)
+    }
+
+    if cfg.alertRTT < 0 || cfg.alertLoss < 0 || cfg.alertLoss > 100 || cfg.alertJit < 0 {
+        fmt.Printf("Alert thresholds (-alert-rtt %v, -alert-loss %v, -alert-jitter %v) out of range. Exiting.\n", cfg.alertRTT, cfg.alertLoss, cfg.alertJit)
+        os.Exit(1)
+    }
+
+    // The graph draws the -warn and -crit RTTs as well.
+    badThreshold := 1
+    if cfg.nagios {
+        badThreshold = nagiosUnknown
+    }
+    var err error
+    if cfg.warnLimit, err = parseThreshold(cfg.warn); err != nil {
+        fmt.Printf("Invalid -warn value: %v. Exiting.\n", err)
+        os.Exit(badThreshold)
+    }
+    if cfg.critLimit, err = parseThreshold(cfg.crit); err != nil {
+        fmt.Printf("Invalid -crit value: %v. Exiting.\n", err)
+        os.Exit(badThreshold)
+    }
+    if cfg.baseline < 0 {
+        fmt.Printf("Baseline (-baseline) value %v must not be negative. Exiting.\n", cfg.baseline)
+        os.Exit(1)
+    }
+    if cfg.nagios && !cfg.batch() {
+        cfg.count = nagiosDefaultCount
+    }
+
+    if cfg.central != "mean" && cfg.central != "median" {
+        fmt.Printf("Invalid -central value %q (want mean or median). Exiting.\n", cfg.central)
+        os.Exit(1)
+    }
+
+    if cfg.statsTmpl != "" {
+        var err error
+        if cfg.statsLayout, err = parseStatsTemplate(cfg.statsTmpl); err != nil {
+            fmt.Printf("Invalid -stats-template: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+    }
+
+    if cfg.movingAvg < 0 {
+        fmt.Printf("Moving average (-ma) sample count %d must not be negative. Exiting.\n", cfg.movingAvg)
+        os.Exit(1)
+    }
+
+    if cfg.warmup < 0 {
+        fmt.Printf("Warmup (-warmup) value %d must not be negative. Exiting.\n", cfg.warmup)
+        os.Exit(1)
+    }
+
+    if cfg.count < 0 || cfg.duration < 0 || cfg.maxBytes < 0 {
+        fmt.Println("Probe count (-n), -duration and -max-bytes must not be negative. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.selfCheck < 0 {
+        fmt.Printf("Self-check time limit (-self-check) %v must not be negative. Exiting.\n", cfg.selfCheck)
+        os.Exit(1)
+    }
+    if cfg.selfCheck > 0 && cfg.replayFile != "" {
+        fmt.Println("-self-check cannot be combined with -replay. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.maxMemMB < 0 {
+        fmt.Printf("Memory budget (-max-mem-mb) %d must not be negative. Exiting.\n", cfg.maxMemMB)
+        os.Exit(1)
+    }
+    if cfg.batch() && cfg.replayFile != "" {
+        fmt.Println("-n, -duration and -max-bytes cannot be combined with -replay. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.classic && (cfg.nagios || cfg.replayFile != "") {
+        fmt.Println("-classic cannot be combined with -nagios or -replay. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.untilUp && cfg.untilDown {
+        fmt.Println("-until-up and -until-down cannot be combined. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.until() && (cfg.batch() || cfg.nagios || cfg.replayFile != "") {
+        fmt.Println("-until-up and -until-down cannot be combined with -n, -duration, -max-bytes, -nagios or -replay. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.untilLimit < 0 {
+        fmt.Printf("Total timeout (-timeout-total) value %v must not be negative. Exiting.\n", cfg.untilLimit)
+        os.Exit(1)
+    }
+    if cfg.daemon {
+        switch {
+        case cfg.batch() || cfg.until() || cfg.nagios || cfg.classic || cfg.oneline || cfg.replayFile != "":
+            fmt.Println("-daemon runs until stopped and cannot be combined with -n, -duration, -max-bytes, -until-up, -until-down, -nagios, -classic, -oneline or -replay. Exiting.")
+            os.Exit(1)
+        case cfg.logFile == "" && cfg.export == "" && cfg.influxURL == "" && cfg.otlpURL == "" && cfg.webhook == "":
+            fmt.Println("-daemon needs an output: -log, -export, -influx, -otlp or -webhook. Exiting.")
+            os.Exit(1)
+        }
+    }
+    if cfg.asciiPlot < 0 {
+        fmt.Printf("ASCII plot interval (-ascii-plot) value %v must not be negative. Exiting.\n", cfg.asciiPlot)
+        os.Exit(1)
+    }
+    if cfg.asciiPlot > 0 {
+        switch {
+        case cfg.batch() || cfg.until() || cfg.nagios || cfg.classic || cfg.oneline:
+            fmt.Println("-ascii-plot cannot be combined with -n, -duration, -max-bytes, -until-up, -until-down, -nagios, -classic or -oneline. Exiting.")
+            os.Exit(1)
+        case cfg.daemon && cfg.logFile == "":
+            fmt.Println("-ascii-plot with -daemon writes to -log, which is not given. Exiting.")
+            os.Exit(1)
+        }
+    }
+    switch {
+    case cfg.priority != "" && cfg.priority != "high" && cfg.priority != "realtime":
+        fmt.Printf("Invalid -priority value %q, use high or realtime. Exiting.\n", cfg.priority)
+        os.Exit(1)
+    case cfg.priority != "" && !prioritySupported:
+        fmt.Fprintln(os.Stderr, "-priority is only supported on Linux, running at normal priority.")
+    case cfg.priority != "":
+        if err := raisePriority(cfg.priority); err != nil {
+            fmt.Printf("Could not raise the priority for -priority %s: %v. It needs root or CAP_SYS_NICE. Exiting.\n", cfg.priority, err)
+            os.Exit(1)
+        }
+    }
+    if cfg.rawOut && (cfg.until() || cfg.nagios || cfg.classic || cfg.oneline || cfg.daemon || cfg.diff || cfg.asciiPlot > 0 || cfg.sweep != "" || cfg.audio) {
+        fmt.Println("-raw prints the samples instead of the graph and cannot be combined with -until-up, -until-down, -nagios, -classic, -oneline, -daemon, -diff, -ascii-plot, -sweep or -audio. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.sweep != "" {
+        sizes, err := parseSweep(cfg.sweep)
+        switch {
+        case err != nil:
+            fmt.Printf("Invalid -sweep value: %v. Exiting.\n", err)
+            os.Exit(1)
+        case cfg.sweepCount < 1 || cfg.sweepCycles < 0:
+            fmt.Printf("-sweep-count %d must be at least 1 and -sweep-cycles %d not negative. Exiting.\n", cfg.sweepCount, cfg.sweepCycles)
+            os.Exit(1)
+        case cfg.batch() || cfg.until() || cfg.nagios || cfg.classic || cfg.oneline || cfg.daemon || cfg.diff || cfg.asciiPlot > 0:
+            fmt.Println("-sweep prints its own chart and cannot be combined with -n, -duration, -max-bytes, -until-up, -until-down, -nagios, -classic, -oneline, -daemon, -diff or -ascii-plot. Exiting.")
+            os.Exit(1)
+        case cfg.replayFile != "" || cfg.mtuCheck || cfg.owd:
+            fmt.Println("-sweep cannot be combined with -replay, -mtu-check or -owd. Exiting.")
+            os.Exit(1)
+        }
+        cfg.sweepSizes = sizes
+    }
+    if cfg.failLoss < 0 || cfg.failRTT < 0 {
+        fmt.Printf("Health thresholds (-fail-loss %v, -fail-rtt %v) must not be negative. Exiting.\n", cfg.failLoss, cfg.failRTT)
+        os.Exit(1)
+    }
+
+    if cfg.mtuCheck {
+        switch {
+        case cfg.payloadSize <= mtuSmallPayload:
+            fmt.Printf("-mtu-check compares the -s probes with %d byte ones and needs -s above %d. Exiting.\n", mtuSmallPayload, mtuSmallPayload)
+            os.Exit(1)
+        case cfg.replayFile != "":
+            fmt.Println("-mtu-check cannot be combined with -replay. Exiting.")
+            os.Exit(1)
+        }
+    }
+    if cfg.owd && cfg.replayFile != "" {
+        fmt.Println("-owd cannot be combined with -replay. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.dnsRetries < 0 {
+        fmt.Printf("Resolve retries (-resolve-retries) value %d must not be negative. Exiting.\n", cfg.dnsRetries)
+        os.Exit(1)
+    }
+    if cfg.dnsInterval < 0 {
+        fmt.Printf("Resolve interval (-resolve-interval) value %v must not be negative. Exiting.\n", cfg.dnsInterval)
+        os.Exit(1)
+    }
+    if cfg.diff {
+        switch {
+        case cfg.batch() || cfg.until() || cfg.nagios || cfg.classic || cfg.oneline || cfg.daemon || cfg.asciiPlot > 0:
+            fmt.Println("-diff plots the difference in the graph and cannot be combined with -n, -duration, -max-bytes, -until-up, -until-down, -nagios, -classic, -oneline, -daemon or -ascii-plot. Exiting.")
+            os.Exit(1)
+        case cfg.aggregate > 0 || cfg.plotDNS:
+            fmt.Println("-diff cannot be combined with -aggregate or -plot-dns. Exiting.")
+            os.Exit(1)
+        }
+    }
+    if cfg.splitScale && cfg.diff {
+        fmt.Println("-split-scale cannot be combined with -diff, a difference has no log scale. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.yMax < 0 {
+        fmt.Printf("Y axis top (-ymax) value %v must not be negative. Exiting.\n", cfg.yMax)
+        os.Exit(1)
+    }
+    if cfg.yMax > 0 && cfg.diff {
+        fmt.Println("-ymax cannot be combined with -diff. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.band < 0 {
+        fmt.Printf("Band window (-band) value %d must not be negative. Exiting.\n", cfg.band)
+        os.Exit(1)
+    }
+    if cfg.band > 0 && (cfg.aggregate > 0 || cfg.diff) {
+        fmt.Println("-band shades the range of single samples and cannot be combined with -aggregate or -diff. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.plotDNS && cfg.aggregate > 0 {
+        fmt.Println("-plot-dns cannot be combined with -aggregate. Exiting.")
+        os.Exit(1)
+    }
+
+    if cfg.lossWindow <= 0 {
+        fmt.Printf("Loss window (-loss-window) value %v must be positive. Exiting.\n", cfg.lossWindow)
+        os.Exit(1)
+    }
+    if cfg.aggregate < 0 {
+        fmt.Printf("Aggregation window (-aggregate) value %v must not be negative. Exiting.\n", cfg.aggregate)
+        os.Exit(1)
+    }
+
+    if cfg.bloatRatio != 0 && cfg.bloatRatio <= 1 {
+        fmt.Printf("Bufferbloat ratio (-bloat-ratio) value %v must be above 1 or 0 to disable. Exiting.\n", cfg.bloatRatio)
+        os.Exit(1)
+    }
+
+    family := familyAuto
+    flag.Visit(func(f *flag.Flag) {
+        if f.Name == "6" {
+            family = familyIPv4
+            if cfg.useIPv6 {
+                family = familyIPv6
+            }
+        }
+    })
+    if cfg.prefer != "4" && cfg.prefer != "6" {
+        fmt.Printf("Invalid -prefer value %q (want 4 or 6). Exiting.\n", cfg.prefer)
+        os.Exit(1)
+    }
+
+    switch cfg.gapStyle {
+    case "break", "interpolate", "dim":
+    default:
+        fmt.Printf("Invalid -gap-style value %q (want break, interpolate or dim). Exiting.\n", cfg.gapStyle)
+        os.Exit(1)
+    }
+    switch cfg.smallTerm {
+    case "wait", "oneline":
+    default:
+        fmt.Printf("Invalid -small-terminal value %q (want wait or oneline). Exiting.\n", cfg.smallTerm)
+        os.Exit(1)
+    }
+    if !applyTheme(cfg.theme) {
+        fmt.Printf("Invalid -theme value %q (want dark, light or mono). Exiting.\n", cfg.theme)
+        os.Exit(1)
+    }
+    if cfg.jitterGaps != "skip" && cfg.jitterGaps != "break" {
+        fmt.Printf("Invalid -jitter-gaps value %q (want skip or break). Exiting.\n", cfg.jitterGaps)
         os.Exit(1)
     }
 
-    resolvedHost, err := resolveHostname(host, *useIPv6)
+    check, err := pinger.ParsePayloadCheck(cfg.verify)
     if err != nil {
-        fmt.Printf("Could not resolve host %s. Exiting.\n", host)
+        fmt.Printf("Invalid -payload-check value: %v. Exiting.\n", err)
+        os.Exit(1)
+    }
+    cfg.verify = check.String()
+    if check == pinger.CheckHash && cfg.payloadSize < pinger.HashSize {
+        fmt.Printf("-payload-check hash needs a payload (-s) of at least %d bytes. Exiting.\n", pinger.HashSize)
         os.Exit(1)
     }
 
-    // Initialize variables
-    var times []float64
-    var pings []int
-    var mutex sync.Mutex
-    running := true
-    currentScale := "linear"
-    pingCount := 0
+    selector, err := parseAddrSelect(cfg.addrSelect)
+    if err != nil {
+        fmt.Printf("Invalid -addr-select value: %v. Exiting.\n", err)
+        os.Exit(1)
+    }
 
-    startTime := time.Now()
+    if cfg.dualStack {
+        switch {
+        case family != familyAuto:
+            fmt.Printf("-happy-eyeballs pings both address families and cannot be combined with -6. Exiting.\n")
+            os.Exit(1)
+        case selector.all:
+            fmt.Printf("-happy-eyeballs compares one address per family and cannot be combined with -addr-select all. Exiting.\n")
+            os.Exit(1)
+        case cfg.replayFile != "":
+            fmt.Printf("-happy-eyeballs cannot be combined with -replay. Exiting.\n")
+            os.Exit(1)
+        }
+    }
 
-    // Start the ping goroutine
-    var wg sync.WaitGroup
-    wg.Add(1)
-    go func() {
-        defer wg.Done()
-        ping(resolvedHost, &times, &pings, &mutex, *timeout, *deadTimeout, *interval, &running, &pingCount, *useIPv6)
-    }()
-
-    // Initialize termui
-    if err := termui.Init(); err != nil {
-        fmt.Printf("Failed to initialize termui: %v\n", err)
-        os.Exit(1)
-    }
-    defer termui.Close()
-
-    // Create UI elements
-    plot := widgets.NewPlot()
-    plot.Title = fmt.Sprintf("Ping response times to %s%s", func() string {
-        if *useIPv6 {
-            return "IPv6 "
-        }
-        return "IPv4 "
-    }(), host)
-    plot.Data = make([][]float64, 1)
-    plot.Marker = widgets.MarkerBraille
-    plot.LineColors[0] = termui.ColorGreen
-
-    // Create stats paragraph
-    statsParagraph := widgets.NewParagraph()
-    statsParagraph.Title = "Statistics"
-    statsParagraph.Text = "Calculating..."
-
-    // Set up grid layout
-    grid := termui.NewGrid()
-    termWidth, termHeight := termui.TerminalDimensions()
-    grid.SetRect(0, 0, termWidth, termHeight)
-
-    grid.Set(
-        termui.NewRow(0.7, plot),
-        termui.NewRow(0.3, statsParagraph),
-    )
-
-    // Handle events
-    uiEvents := termui.PollEvents()
-    ticker := time.NewTicker(time.Second)
-    defer ticker.Stop()
-
-    // Handle Ctrl+C and 'q' to quit
-    sigs := make(chan os.Signal, 1)
-    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-    go func() {
-        <-sigs
-        running = false
-        termui.Close()
-        fmt.Println("Exiting...")
-        os.Exit(0)
-    }()
-
-    for running {
-        select {
-        case e := <-uiEvents:
-            switch e.Type {
-            case termui.KeyboardEvent:
-                switch e.ID {
-                case "q", "<C-c>":
-                    running = false
-                    termui.Close()
-                    fmt.Println("Exiting...")
-                    os.Exit(0)
-                case "l":
-                    if currentScale == "linear" {
-                        currentScale = "log"
-                    } else {
-                        currentScale = "linear"
-                    }
-                }
-            case termui.ResizeEvent:
-                payload := e.Payload.(termui.Resize)
-                grid.SetRect(0, 0, payload.Width, payload.Height)
-                termui.Clear()
+    if cfg.analyze != "" {
+        if len(flag.Args()) > 0 || cfg.replayFile != "" || cfg.nagios {
+            fmt.Println("-analyze reads its samples from the export file and cannot be combined with hosts, -replay or -nagios. Exiting.")
+            os.Exit(1)
+        }
+        os.Exit(runAnalyze(cfg))
+    }
+
+    var targets []*target
+    var replayRecords []exportRecord
+    var replayOwners []*target
+    var replayNotes []note
+    if cfg.replayFile != "" {
+        replayRecords, err = readExport(cfg.replayFile)
+        if err != nil {
+            fmt.Printf("Could not read replay file %s: %v. Exiting.\n", cfg.replayFile, err)
+            os.Exit(1)
+        }
+        replayRecords, replayNotes = splitNotes(replayRecords)
+        if len(replayRecords) == 0 {
+            fmt.Printf("Replay file %s contains no samples. Exiting.\n", cfg.replayFile)
+            os.Exit(1)
+        }
+        targets, replayOwners = replayTargets(replayRecords)
+    } else {
+        for _, host := range flag.Args() {
+            if cfg.dualStack {
+                targets = append(targets, raceTargets(host, selector, cfg.warmup, cfg.dnsRetries, len(targets))...)
+                continue
+            }
+            addrs, hostIPv6, resolved, took, err := retryResolve(host, family, cfg.prefer == "6", cfg.dnsRetries)
+            var wrongFamily *familyError
+            if errors.As(err, &wrongFamily) {
+                fmt.Printf("%v, %s. Exiting.\n", err, wrongFamily.hint())
+                os.Exit(1)
+            }
+            if err != nil {
+                fmt.Printf("Could not resolve host %s. Exiting.\n", host)
+                os.Exit(1)
             }
-        case <-ticker.C:
-            // Update plot and stats
-            mutex.Lock()
-            plotData := make([]float64, len(times))
-            copy(plotData, times)
-            mutex.Unlock()
-
-            if len(plotData) > 0 {
-                if currentScale == "log" {
-                    transformedData := make([]float64, len(plotData))
-                    for i, v := range plotData {
-                        if v > 0 {
-                            transformedData[i] = math.Log10(v)
-                        } else {
-                            transformedData[i] = 0
-                        }
-                    }
-                    plot.Data[0] = transformedData
-                    plot.MaxVal = maxFloat64(transformedData)
-                    // plot.MinVal is not available; termui handles MinVal internally
-                } else {
-                    plot.Data[0] = plotData
-                    plot.MaxVal = maxFloat64(plotData)
-                    // plot.MinVal is not available; termui handles MinVal internally
+            addrs, err = selector.pick(host, addrs)
+            if err != nil {
+                fmt.Printf("%v. Exiting.\n", err)
+                os.Exit(1)
+            }
+            for _, addr := range addrs {
+                t := newTarget(host, addr, hostIPv6, len(targets))
+                if !isLiteral(host) {
+                    t.addLookup(resolved, took, nil)
                 }
+                targets = append(targets, t)
             }
+        }
+    }
 
-            // Update stats
-            statsText := updateStats(&times, *timeout, *deadTimeout, startTime, *interval)
-            statsParagraph.Text = statsText
-
-            if len(plotData) >= 2 {
-                // [update plot data and render]
-                // Render UI
-                termui.Render(grid)
-            } else {
-                // Only update stats
-                statsText := updateStats(&times, *timeout, *deadTimeout, startTime, *interval)
-                statsParagraph.Text = statsText
+    if cfg.diff && len(targets) != 2 {
+        fmt.Printf("-diff compares two targets, but %d are given. Exiting.\n", len(targets))
+        os.Exit(1)
+    }
+    if cfg.icmpType < -1 || cfg.icmpType > 255 || cfg.icmpCode < -1 || cfg.icmpCode > 255 {
+        fmt.Printf("ICMP type (-icmp-type) %d and code (-icmp-code) %d must be between 0 and 255. Exiting.\n", cfg.icmpType, cfg.icmpCode)
+        os.Exit(1)
+    }
+    if cfg.raw() && (cfg.replayFile != "" || cfg.mtuCheck) {
+        fmt.Println("-icmp-type and -icmp-code cannot be combined with -replay or -mtu-check. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.echoID < -1 || cfg.echoID > 0xffff {
+        fmt.Printf("ICMP identifier (-id) value %d does not fit in 16 bits. Exiting.\n", cfg.echoID)
+        os.Exit(1)
+    }
+    if cfg.echoID >= 0 && cfg.randomID {
+        fmt.Println("-id and -random-id cannot be combined. Exiting.")
+        os.Exit(1)
+    }
+    if cfg.echoID >= 0 || cfg.randomID {
+        base := cfg.echoID
+        if cfg.randomID {
+            base = randomEchoID()
+        }
+        for _, t := range targets {
+            t.id = (base + t.index) & 0xffff
+        }
+    }
+    if cfg.flowLabel < 0 || cfg.flowLabel > pinger.MaxFlowLabel {
+        fmt.Printf("Flow label (-flowlabel) value %d does not fit in 20 bits. Exiting.\n", cfg.flowLabel)
+        os.Exit(1)
+    }
+    for _, t := range targets {
+        if cfg.flowLabel != 0 && !t.useIPv6 {
+            fmt.Printf("Flow label (-flowlabel) is IPv6 only, but %s is an IPv4 target. Exiting.\n", t.name())
+            os.Exit(1)
+        }
+    }
+
+    if cfg.source != "" {
+        source := net.ParseIP(cfg.source)
+        switch {
+        case source == nil:
+            fmt.Printf("Source address (-source) %q is not an IP address. Exiting.\n", cfg.source)
+            os.Exit(1)
+        case cfg.replayFile != "":
+            fmt.Println("-source cannot be combined with -replay. Exiting.")
+            os.Exit(1)
+        }
+        for _, t := range targets {
+            if (source.To4() == nil) != t.useIPv6 {
+                fmt.Printf("Source address (-source) %s is not of the address family of %s. Exiting.\n", cfg.source, t.name())
+                os.Exit(1)
             }
-          }
+        }
+        // Only an address of this host can be bound, replies to any other
+        // would not come back here to be measured.
+        probe, err := net.ListenPacket("udp", net.JoinHostPort(cfg.source, "0"))
+        if err != nil {
+            fmt.Printf("Cannot send from -source %s, it must be an address of this host: %v. Exiting.\n", cfg.source, err)
+            os.Exit(1)
+        }
+        probe.Close()
     }
-    wg.Wait()
-}
 
-func resolveHostname(host string, useIPv6 bool) (string, error) {
-    var ipAddr string
-    ips, err := net.LookupIP(host)
-    if err != nil {
-        return "", fmt.Errorf("Failed to resolve hostname %s with error: %v", host, err)
+    for _, t := range targets {
+        newHostStatus(t, cfg)
     }
-    for _, ip := range ips {
-        if useIPv6 && ip.To16() != nil && ip.To4() == nil {
-            ipAddr = ip.String()
-            break
-        } else if !useIPv6 && ip.To4() != nil {
-            ipAddr = ip.String()
-            break
-        }
-    }
-    if ipAddr == "" {
-        return "", fmt.Errorf("No %s address found for host %s", func() string {
-            if useIPv6 {
-                return "IPv6"
-            }
-            return "IPv4"
-        }(), host)
+
+    // -low-power only matters for the display modes, a batch run computes
+    // its stats once at the end.
+    var wake chan struct{}
+    if cfg.lowPower && !cfg.batch() {
+        wake = make(chan struct{}, 1)
+        for _, t := range targets {
+            t.running = newRunningStats(cfg)
+            t.observers = append(t.observers, anomalyWaker(cfg, wake))
+        }
     }
-    return ipAddr, nil
-}
 
-func ping(host string, times *[]float64, pings *[]int, mutex *sync.Mutex, timeout int, deadTimeout float64, interval float64, running *bool, pingCount *int, useIPv6 bool) {
-    var network string
-    if runtime.GOOS == "windows" {
-        if useIPv6 {
-            network = "ip6:ipv6-icmp"
-        } else {
-            network = "ip4:icmp"
+    if cfg.audio {
+        ticker := newAudioTicker(os.Stdout, cfg.audioGap)
+        for _, t := range targets {
+            t.observers = append(t.observers, ticker.observe)
         }
-    } else {
-        if useIPv6 {
-            network = "ip6:ipv6-icmp"
-        } else {
-            network = "ip4:icmp"
+    }
+
+    if cfg.rawOut {
+        writer := &rawWriter{lost: cfg.rawLost, hosts: len(targets) > 1}
+        for _, t := range targets {
+            t.observers = append(t.observers, writer.observe)
         }
     }
 
-    conn, err := icmp.ListenPacket(network, "")
-    if err != nil {
-        fmt.Printf("Error listening to ICMP: %v\n", err)
-        *running = false
-        return
+    var outputs daemonOutputs
+    var notes noteLog
+    if cfg.influxURL != "" {
+        writer, err := newInfluxWriter(cfg.influxURL, cfg.influxFlush)
+        if err != nil {
+            fmt.Printf("Invalid -influx value: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        go writer.run()
+        for _, t := range targets {
+            t.observers = append(t.observers, writer.observe)
+        }
+        outputs.flush = append(outputs.flush, writer.flush)
     }
-    defer conn.Close()
-
-    id := os.Getpid() & 0xffff
-
-    for *running {
-        *pingCount++
-        var msg *icmp.Message
-        if useIPv6 {
-            msg = &icmp.Message{
-                Type: ipv6.ICMPTypeEchoRequest,
-                Code: 0,
-                Body: &icmp.Echo{
-                    ID:   id,
-                    Seq:  *pingCount,
-                    Data: []byte("HELLO-PING"),
-                },
-            }
-        } else {
-            msg = &icmp.Message{
-                Type: ipv4.ICMPTypeEcho,
-                Code: 0,
-                Body: &icmp.Echo{
-                    ID:   id,
-                    Seq:  *pingCount,
-                    Data: []byte("HELLO-PING"),
-                },
-            }
+
+    if cfg.otlpURL != "" {
+        if cfg.otlpPeriod <= 0 {
+            fmt.Printf("Invalid -otlp-interval value: must be positive. Exiting.\n")
+            os.Exit(1)
+        }
+        exporter, err := newOTLPExporter(cfg.otlpURL, cfg.otlpPeriod)
+        if err != nil {
+            fmt.Printf("Invalid -otlp value: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        for _, t := range targets {
+            t.observers = append(t.observers, exporter.observe)
         }
+        outputs.flush = append(outputs.flush, exporter.flush)
+    }
+
+    if cfg.export != "" {
+        writer, err := newExportWriter(cfg.export)
+        if err != nil {
+            fmt.Printf("Could not create export file %s: %v. Exiting.\n", cfg.export, err)
+            os.Exit(1)
+        }
+        for _, t := range targets {
+            t.observers = append(t.observers, writer.observe)
+        }
+        notes.onNote(writer.note)
+        outputs.reopen = append(outputs.reopen, writer.reopen)
+    }
 
-        msgBytes, err := msg.Marshal(nil)
+    if cfg.bucketFile != "" {
+        if cfg.bucket <= 0 {
+            fmt.Printf("Bucket width (-bucket) value %v must be positive. Exiting.\n", cfg.bucket)
+            os.Exit(1)
+        }
+        writer, err := newBucketWriter(cfg.bucketFile, cfg)
         if err != nil {
-            fmt.Printf("Error marshalling ICMP message: %v\n", err)
-            *running = false
-            return
+            fmt.Printf("Could not create -export-buckets file %s: %v. Exiting.\n", cfg.bucketFile, err)
+            os.Exit(1)
+        }
+        for _, t := range targets {
+            t.observers = append(t.observers, writer.observe)
+        }
+        outputs.flush = append(outputs.flush, writer.flush)
+    }
+
+    if cfg.fifo != "" {
+        if err := createFIFO(cfg.fifo); err != nil {
+            fmt.Printf("Could not create FIFO %s: %v. Exiting.\n", cfg.fifo, err)
+            os.Exit(1)
         }
+    }
 
-        destAddr := &net.IPAddr{IP: net.ParseIP(host)}
+    var webListener net.Listener
+    if cfg.web != "" {
+        var err error
+        if webListener, err = net.Listen("tcp", cfg.web); err != nil {
+            fmt.Printf("Could not listen on -web address %s: %v. Exiting.\n", cfg.web, err)
+            os.Exit(1)
+        }
+    }
 
-        start := time.Now()
-        n, err := conn.WriteTo(msgBytes, destAddr)
+    var alertHandlers []alertHandler
+    if cfg.alertBell {
+        alertHandlers = append(alertHandlers, bellAlertHandler(os.Stdout))
+    }
+    if cfg.webhook != "" {
+        notifier, err := newWebhookNotifier(cfg.webhook)
         if err != nil {
-            fmt.Printf("Error sending ICMP request: %v\n", err)
-            mutex.Lock()
-            *times = append(*times, deadTimeout)
-            *pings = append(*pings, *pingCount)
-            mutex.Unlock()
-            time.Sleep(time.Duration(interval * float64(time.Second)))
-            continue
+            fmt.Printf("Invalid -webhook value: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        go notifier.run()
+        alertHandlers = append(alertHandlers, notifier.handle)
+    }
+    if cfg.notify {
+        if !desktopNotifySupported {
+            fmt.Println("Desktop notifications (-notify) are not supported on this platform. Exiting.")
+            os.Exit(1)
         }
+        alertHandlers = append(alertHandlers, desktopAlertHandler())
+    }
 
-        if n != len(msgBytes) {
-            fmt.Printf("Sent %d bytes, expected to send %d bytes\n", n, len(msgBytes))
+    if cfg.logFile != "" {
+        file, err := os.OpenFile(cfg.logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+        if err != nil {
+            fmt.Printf("Could not open log file %s: %v. Exiting.\n", cfg.logFile, err)
+            os.Exit(1)
         }
+        defer file.Close()
+        diag.setFile(file)
+        outputs.reopen = append(outputs.reopen, func() error {
+            return diag.reopenFile(cfg.logFile)
+        })
+    }
+    // Diagnostics would garble the graph, the status line and the single
+    // line of a -nagios check, and flood a wait for -until-up.
+    // -raw output is only the samples, the diagnostics still go to -log.
+    diag.mute(cfg.rawOut || !cfg.verbose && (!cfg.batch() || cfg.nagios || cfg.until() || cfg.classic))
 
-        conn.SetReadDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond))
-        reply := make([]byte, 1500)
-        n, peer, err := conn.ReadFrom(reply)
-        duration := time.Since(start)
+    opts := pinger.Options{
+        Interval:         time.Duration(cfg.interval * float64(time.Second)),
+        Schedule:         cfg.schedule,
+        Timeout:          time.Duration(cfg.timeout) * time.Millisecond,
+        PayloadSize:      cfg.payloadSize,
+        BufSize:          cfg.bufSize,
+        FlowLabel:        cfg.flowLabel,
+        Source:           cfg.source,
+        DontFragment:     cfg.dontFrag || cfg.mtuCheck,
+        Broadcast:        cfg.broadcast,
+        Drain:            cfg.drain,
+        PayloadCheck:     check,
+        KernelTimestamps: cfg.hwTimestamp,
+        Raw:              cfg.raw(),
+        Logf:             diag.Printf,
+    }
+    if cfg.raw() {
+        opts.RawType, opts.RawCode = cfg.icmpType, max(cfg.icmpCode, 0)
+    }
+    if cfg.selfCheck > 0 && !selfCheck(targets, opts, cfg.selfCheck) {
+        fmt.Println("Self-check failed. Exiting.")
+        os.Exit(1)
+    }
 
+    if cfg.daemon {
+        // Everything was checked, whatever still fails is only logged.
+        pid, err := detach()
         if err != nil {
-            if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-                fmt.Printf("Ping to %s timed out\n", host)
-                mutex.Lock()
-                *times = append(*times, deadTimeout)
-                *pings = append(*pings, *pingCount)
-                mutex.Unlock()
-            } else {
-                fmt.Printf("Error receiving ICMP reply: %v\n", err)
-                mutex.Lock()
-                *times = append(*times, deadTimeout)
-                *pings = append(*pings, *pingCount)
-                mutex.Unlock()
-            }
-        } else {
-            // Parse reply
-            var protocol int
-            if useIPv6 {
-                protocol = ipv6.ICMPTypeEchoReply.Protocol()
-            } else {
-                protocol = ipv4.ICMPTypeEchoReply.Protocol()
-            }
-            receivedMsg, err := icmp.ParseMessage(protocol, reply[:n])
-            if err != nil {
-                fmt.Printf("Error parsing ICMP reply: %v\n", err)
-                mutex.Lock()
-                *times = append(*times, deadTimeout)
-                *pings = append(*pings, *pingCount)
-                mutex.Unlock()
-            } else {
-                switch receivedMsg.Type {
-                case ipv4.ICMPTypeEchoReply, ipv6.ICMPTypeEchoReply:
-                    delay := float64(duration.Milliseconds())
-                    mutex.Lock()
-                    *times = append(*times, delay)
-                    *pings = append(*pings, *pingCount)
-                    mutex.Unlock()
-                    if delay > float64(timeout) {
-                        fmt.Printf("Ping response time %.2f ms exceeded timeout of %d ms\n", delay, timeout)
-                    }
-                default:
-                    fmt.Printf("Received non-echo reply from %v: %+v\n", peer, receivedMsg)
-                    mutex.Lock()
-                    *times = append(*times, deadTimeout)
-                    *pings = append(*pings, *pingCount)
-                    mutex.Unlock()
+            fmt.Printf("Could not start in the background: %v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        if pid != 0 {
+            fmt.Printf("Running in the background, pid %d\n", pid)
+            os.Exit(0)
+        }
+    }
+
+    var waiter *untilWaiter
+    if cfg.until() {
+        waiter = newUntilWaiter(cfg.untilUp, targets)
+    }
+
+    // Initialize variables
+    running := true
+
+    startTime := time.Now()
+    for _, n := range replayNotes {
+        notes.add(n)
+    }
+    if cfg.note != "" {
+        notes.add(note{Time: startTime, Text: cfg.note})
+    }
+
+    if cfg.classic {
+        for _, t := range targets {
+            classicHeader(t, cfg.payloadSize)
+        }
+    }
+
+    // Start one ping goroutine per target
+    ctx, cancel := context.WithCancel(context.Background())
+    if cfg.duration > 0 {
+        ctx, cancel = context.WithTimeout(context.Background(), cfg.duration)
+    }
+    defer cancel()
+    // The -mtu-check and -owd checks are attached to the targets here,
+    // before any goroutine reads them. Their probes stop with the target's
+    // own.
+    checks := make([][]func(), len(targets))
+    stopChecks := make([]context.CancelFunc, len(targets))
+    for i, t := range targets {
+        checkCtx, stop := context.WithCancel(ctx)
+        stopChecks[i] = stop
+        if cfg.replayFile != "" {
+            continue
+        }
+        if cfg.mtuCheck {
+            checks[i] = append(checks[i], newMTUCheck(checkCtx, t, opts).run)
+        }
+        if cfg.owd {
+            checks[i] = append(checks[i], newOWDCheck(checkCtx, t, opts).run)
+        }
+    }
+    if cfg.dnsInterval > 0 && cfg.replayFile == "" {
+        go resolveLoop(ctx, targets, cfg.dnsInterval)
+    }
+    if cfg.maxBytes > 0 {
+        go limitVolume(ctx, cancel, targets, cfg.maxBytes)
+    }
+    if cfg.maxMemMB > 0 {
+        go limitMemory(ctx, targets, cfg.maxMemMB)
+    }
+    if cfg.fifo != "" {
+        go runFIFO(ctx, cfg.fifo, cfg, targets, startTime)
+    }
+    if webListener != nil {
+        go runWeb(ctx, webListener, cfg, targets, startTime)
+    }
+    if cfg.sweep != "" {
+        code := runSweep(ctx, cfg, targets, opts)
+        cancel()
+        os.Exit(code)
+    }
+    var wg sync.WaitGroup
+    if cfg.replayFile != "" {
+        go replay(ctx, replayRecords, replayOwners, cfg.replaySpeed, cfg.deadTimeout)
+    } else {
+        for i, t := range targets {
+            wg.Add(1)
+            go func(i int, t *target) {
+                defer wg.Done()
+                defer stopChecks[i]()
+                for _, run := range checks[i] {
+                    go run()
                 }
-            }
+                ping(ctx, t, opts, cfg, &running)
+            }(i, t)
+        }
+    }
+
+    if cfg.daemon {
+        code := runDaemon(cfg, targets, alertHandlers, &outputs, &running)
+        cancel()
+        wg.Wait()
+        outputs.flushAll()
+        snapshotOnExit(cfg, targets)
+        os.Exit(code)
+    } else if cfg.until() {
+        code := runUntil(cfg, waiter, targets, startTime, &wg, &running)
+        cancel()
+        outputs.flushAll()
+        snapshotOnExit(cfg, targets)
+        os.Exit(code)
+    } else if cfg.rawOut {
+        code := runRaw(&wg, cancel, &running)
+        cancel()
+        outputs.flushAll()
+        snapshotOnExit(cfg, targets)
+        os.Exit(code)
+    } else if cfg.batch() || cfg.classic {
+        code := runBatch(cfg, targets, startTime, &wg, cancel, &running)
+        cancel()
+        outputs.flushAll()
+        snapshotOnExit(cfg, targets)
+        os.Exit(code)
+    } else if cfg.oneline {
+        runOneline(cfg, targets, alertHandlers, startTime, &running)
+        snapshotOnExit(cfg, targets)
+    } else if cfg.asciiPlot > 0 {
+        runASCIIPlot(cfg, targets, alertHandlers, &running)
+        snapshotOnExit(cfg, targets)
+    } else {
+        title := plotTitle(targets)
+        if cfg.replayFile != "" {
+            title = "Replay of " + cfg.replayFile + ": " + title
+        }
+        if cfg.aggregate > 0 {
+            title += fmt.Sprintf(" (min/avg/max per %v)", cfg.aggregate)
+        }
+        if cfg.raw() {
+            title += fmt.Sprintf(" (ICMP type %d code %d)", cfg.icmpType, max(cfg.icmpCode, 0))
         }
+        if cfg.source != "" {
+            title += " from " + cfg.source
+        }
+        runTUI(cfg, targets, title, alertHandlers, &notes, startTime, wake, &running)
+    }
+    cancel()
+    wg.Wait()
+    outputs.flushAll()
+}
 
-        time.Sleep(time.Duration(interval * float64(time.Second)))
+// randomEchoID returns a random 16-bit ICMP echo identifier.
+func randomEchoID() int {
+    var b [2]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        fmt.Printf("Could not pick a random ICMP identifier: %v. Exiting.\n", err)
+        os.Exit(1)
     }
+    return int(binary.BigEndian.Uint16(b[:]))
 }
 
-func updateStats(times *[]float64, timeout int, deadTimeout float64, startTime time.Time, interval float64) string {
-    totalRunningTime := time.Since(startTime).Seconds()
-    validTimes := []float64{}
-    for _, t := range *times {
-        if t != deadTimeout {
-            validTimes = append(validTimes, t)
+// plotTitle builds the plot title from the hosts as given on the command line
+// and the addresses that are actually being pinged.
+func plotTitle(targets []*target) string {
+    names := make([]string, len(targets))
+    for i, t := range targets {
+        family := "IPv4"
+        if t.useIPv6 {
+            family = "IPv6"
         }
+        names[i] = family + " " + t.name()
     }
+    return "Ping response times to " + strings.Join(names, ", ")
+}
+
+// addrFamily selects which address family resolveHostname returns.
+type addrFamily int
 
-    var avgTime, minTime, maxTime, stdDev, jitter float64
-    if len(validTimes) > 0 {
-        sum := 0.0
-        for _, t := range validTimes {
-            sum += t
+const (
+    familyAuto addrFamily = iota // whatever the host has, see resolveHostname
+    familyIPv4
+    familyIPv6
+)
+
+// resolveHostname returns the addresses of host for the requested family and
+// whether they are IPv6. With familyAuto the family follows the DNS answer:
+// IPv6 for IPv6-only hosts, IPv4 for IPv4-only hosts and the preferred one
+// when the host has both.
+func resolveHostname(host string, family addrFamily, preferIPv6 bool) ([]string, bool, error) {
+    ips, err := net.LookupIP(host)
+    if err != nil {
+        return nil, false, fmt.Errorf("Failed to resolve hostname %s with error: %v", host, err)
+    }
+    var ipv4Addrs, ipv6Addrs []string
+    for _, ip := range ips {
+        if ip.To4() != nil {
+            ipv4Addrs = append(ipv4Addrs, ip.String())
+        } else if ip.To16() != nil {
+            ipv6Addrs = append(ipv6Addrs, ip.String())
         }
-        avgTime = sum / float64(len(validTimes))
+    }
 
-        minTime = validTimes[0]
-        maxTime = validTimes[0]
-        for _, t := range validTimes {
-            if t < minTime {
-                minTime = t
-            }
-            if t > maxTime {
-                maxTime = t
-            }
+    var useIPv6 bool
+    switch family {
+    case familyIPv4:
+        useIPv6 = false
+    case familyIPv6:
+        useIPv6 = true
+    default:
+        useIPv6 = len(ipv4Addrs) == 0 || (preferIPv6 && len(ipv6Addrs) > 0)
+    }
+
+    ipAddrs, otherAddrs := ipv4Addrs, ipv6Addrs
+    if useIPv6 {
+        ipAddrs, otherAddrs = ipv6Addrs, ipv4Addrs
+    }
+    if len(ipAddrs) == 0 {
+        if len(otherAddrs) > 0 {
+            return nil, false, &familyError{host: host, ipv6: useIPv6}
         }
+        return nil, false, fmt.Errorf("No address found for host %s", host)
+    }
+    return ipAddrs, useIPv6, nil
+}
+
+// familyError is returned by resolveHostname when the host only has
+// addresses of the other family. Unlike a DNS failure, resolving again
+// does not help.
+type familyError struct {
+    host string
+    ipv6 bool // the family asked for
+}
+
+func (e *familyError) Error() string {
+    if e.ipv6 {
+        return fmt.Sprintf("Host %s has no IPv6 address, only IPv4", e.host)
+    }
+    return fmt.Sprintf("Host %s has no IPv4 address, only IPv6", e.host)
+}
 
-        // Calculate standard deviation
-        sumSquares := 0.0
-        for _, t := range validTimes {
-            sumSquares += (t - avgTime) * (t - avgTime)
+// hint suggests the option that pings the family the host has.
+func (e *familyError) hint() string {
+    if e.ipv6 {
+        return "try again without -6"
+    }
+    return "try again with -6"
+}
+
+// raceTargets resolves host in both address families for -happy-eyeballs
+// and returns the IPv4 and the IPv6 target, racing each other.
+func raceTargets(host string, selector addrSelector, warmup int, retries int, index int) []*target {
+    var pair []*target
+    for _, family := range []addrFamily{familyIPv4, familyIPv6} {
+        addrs, hostIPv6, resolved, took, err := retryResolve(host, family, false, retries)
+        if err != nil {
+            fmt.Printf("%v, -happy-eyeballs needs both families. Exiting.\n", err)
+            os.Exit(1)
         }
-        stdDev = math.Sqrt(sumSquares / float64(len(validTimes)))
+        addrs, err = selector.pick(host, addrs)
+        if err != nil {
+            fmt.Printf("%v. Exiting.\n", err)
+            os.Exit(1)
+        }
+        t := newTarget(host, addrs[0], hostIPv6, index+len(pair))
+        if !isLiteral(host) {
+            t.addLookup(resolved, took, nil)
+        }
+        pair = append(pair, t)
+    }
+    r := newRace(pair[0], pair[1], warmup)
+    for _, t := range pair {
+        t.observers = append(t.observers, r.observe)
+    }
+    return pair
+}
+
+// ping runs a pinger for t until ctx is done, or -n probes were sent, and
+// records every result. opts holds the settings shared by all targets. A
+// pinger that cannot run stops the whole program.
+func ping(ctx context.Context, t *target, opts pinger.Options, cfg *config, running *bool) {
+    opts.Addr = t.addr
+    opts.IPv6 = t.useIPv6
+    opts.ID = t.id
+    opts.Count = cfg.count
+    p := pinger.New(opts)
+    t.mutex.Lock()
+    t.pinger = p
+    t.mutex.Unlock()
+    err := p.Run(ctx, func(r pinger.Result) {
+        if cfg.classic {
+            classicLine(r)
+        }
+        recordResult(t, r, cfg)
+    })
+    if err != nil {
+        fmt.Printf("Error %v\n", err)
+        if hint := listenErrorHint(err); hint != "" {
+            fmt.Println(hint)
+        }
+        if cfg.daemon {
+            diag.Printf("Error pinging %s: %v\n", t.addr, err)
+        }
+        *running = false
+    }
+}
 
-        // Calculate jitter
-        if len(validTimes) > 1 {
-            sumDiffs := 0.0
-            for i := 1; i < len(validTimes); i++ {
-                sumDiffs += math.Abs(validTimes[i] - validTimes[i-1])
+// recordResult stores a probe result for t. Everything but an echo reply is
+// recorded as lost with the -D value.
+func recordResult(t *target, r pinger.Result, cfg *config) {
+    s := sample{Seq: r.Seq, Time: r.Sent, RTT: cfg.deadTimeout, Lost: true, Status: r.Status.String()}
+    if cfg.debug && r.Raw != nil {
+        diag.Printf("%s reply from %v, %d bytes:\n%s", r.Status, r.Peer, len(r.Raw), hex.Dump(r.Raw))
+    }
+    switch r.Status {
+    case pinger.StatusReply:
+        delay := float64(r.RTT.Milliseconds())
+        if cfg.hwTimestamp || cfg.classic {
+            // Keep the sub-millisecond part the kernel timestamps are for,
+            // and that ping prints.
+            delay = float64(r.RTT) / float64(time.Millisecond)
+        }
+        if cfg.broadcast {
+            t.addResponse(r.Peer.String(), delay)
+            if r.Duplicate {
+                return
             }
-            jitter = sumDiffs / float64(len(validTimes)-1)
-        }
-    }
-
-    // Calculate percentage greater than timeout
-    timesGreaterThanTimeout := 0
-    timesLost := 0
-    for _, t := range *times {
-        if t > float64(timeout) && t != deadTimeout {
-            timesGreaterThanTimeout++
-        }
-        if t == deadTimeout {
-            timesLost++
-        }
-    }
-    percentageGreaterThanTimeout := 0.0
-    percentageLost := 0.0
-    if len(*times) > 0 {
-        percentageGreaterThanTimeout = float64(timesGreaterThanTimeout) / float64(len(*times)) * 100
-        percentageLost = float64(timesLost) / float64(len(*times)) * 100
-    }
-
-    // Calculate maximum sequential number of times >= timeout
-    maxSequentialTimeout := 0
-    currentSequenceTimeout := 0
-    totalTimeout := 0
-    for _, t := range *times {
-        if t >= float64(timeout) && t != deadTimeout {
-            totalTimeout++
-            currentSequenceTimeout++
-        } else if t == deadTimeout {
-            totalTimeout++
-            currentSequenceTimeout++
-        } else {
-            if currentSequenceTimeout > maxSequentialTimeout {
-                maxSequentialTimeout = currentSequenceTimeout
+        }
+        if r.TTL > 0 {
+            if previous, changed := t.updateTTL(r.TTL); changed {
+                diag.Printf("Reply TTL from %s changed from %d to %d, the return path changed\n", t.addr, previous, r.TTL)
             }
-            currentSequenceTimeout = 0
         }
+        if r.Truncated {
+            diag.Printf("Reply from %v truncated to %d bytes of payload, increase -bufsize\n", r.Peer, r.PayloadLen)
+            t.mutex.Lock()
+            t.truncated++
+            t.mutex.Unlock()
+        }
+        if r.Corrupted {
+            diag.Printf("Reply from %v to probe %d has a corrupted payload\n", r.Peer, r.Seq)
+            t.mutex.Lock()
+            t.corrupted++
+            t.mutex.Unlock()
+        }
+        if r.Reordered {
+            diag.Printf("Reply from %v to probe %d arrived after the reply to a later probe\n", r.Peer, r.Seq)
+            t.mutex.Lock()
+            t.reordered++
+            t.mutex.Unlock()
+        }
+        s.RTT = delay
+        s.Lost = false
+        t.record(s)
+        if delay > float64(cfg.slowRTT) {
+            diag.Printf("Ping response time %.2f ms exceeded the slow threshold of %d ms\n", delay, cfg.slowRTT)
+        }
+        return
+    case pinger.StatusSendError:
+        diag.Printf("Error sending ICMP request: %v\n", r.Err)
+    case pinger.StatusTimeout:
+        diag.Printf("Ping to %s timed out\n", t.addr)
+    case pinger.StatusRecvError:
+        diag.Printf("Error receiving ICMP reply: %v\n", r.Err)
+    case pinger.StatusParseError:
+        diag.Printf("Error parsing ICMP reply: %v\n", r.Err)
+    case pinger.StatusUnexpected:
+        diag.Printf("Received non-echo reply from %v: %+v\n", r.Peer, r.Message)
+    case pinger.StatusUnreachable:
+        diag.Printf("Destination unreachable from %v: %s\n", r.Peer, r.Reason)
+        s.Status = r.Reason
+        t.mutex.Lock()
+        t.unreachable[r.Reason]++
+        t.mutex.Unlock()
     }
-    if currentSequenceTimeout > maxSequentialTimeout {
-        maxSequentialTimeout = currentSequenceTimeout
-    }
-
-    statsText := fmt.Sprintf(
-        "Average: %.2f ms\nMax: %.2f ms\nMin: %.2f ms\nStd Dev: %.2f ms\nJitter: %.2f ms\n%% Timeout(>): %.2f%%\n%% Lost(=): %.2f%%\nTotal N: %d\nN timeout: %d\nMax N SEQ tim.: %d\nN lost: %d\n---settings---\n-W timeout: %d ms\n-D: %.0f ms\n-i interval: %.2f s\n\nRunTime: %.2f s\n\nPress 'q' to quit\nPress 'l' to toggle scale",
-        avgTime, maxTime, minTime, stdDev, jitter, percentageGreaterThanTimeout, percentageLost, len(*times), totalTimeout, maxSequentialTimeout, timesLost, timeout, deadTimeout, interval, totalRunningTime)
-    return statsText
+    t.record(s)
 }
 
 func maxFloat64(slice []float64) float64 {
@@ -0,0 +1,72 @@
+package main
+
+import (
+    "context"
+    "runtime"
+    "runtime/debug"
+    "time"
+)
+
+// memoryCheckInterval is how often -max-mem-mb looks at the heap.
+const memoryCheckInterval = 10 * time.Second
+
+// memoryKeepSamples is the number of samples per target that -max-mem-mb
+// never drops, so the graph and the stats still have something to show.
+const memoryKeepSamples = 1000
+
+// limitMemory keeps the heap within max MB for -max-mem-mb: the garbage
+// collector is told about the budget, and while the heap stays above it
+// the oldest half of the samples of every target is dropped. The stats of
+// -low-power keep counting the dropped samples, the others cover what is
+// left.
+func limitMemory(ctx context.Context, targets []*target, max int) {
+    budget := uint64(max) << 20
+    debug.SetMemoryLimit(int64(budget))
+    ticker := time.NewTicker(memoryCheckInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        var m runtime.MemStats
+        runtime.ReadMemStats(&m)
+        if m.HeapAlloc <= budget {
+            continue
+        }
+        dropped := 0
+        for _, t := range targets {
+            dropped += t.dropOldest()
+        }
+        if dropped == 0 {
+            diag.Printf("Memory use %d MB is over -max-mem-mb %d, but no samples are left to drop\n", m.HeapAlloc>>20, max)
+            continue
+        }
+        debug.FreeOSMemory()
+        runtime.ReadMemStats(&m)
+        diag.Printf("Memory use over -max-mem-mb %d, dropped the oldest %d samples, now %d MB\n", max, dropped, m.HeapAlloc>>20)
+    }
+}
+
+// dropOldest forgets the older half of the samples of t, but keeps at
+// least memoryKeepSamples. The rest is copied, so the old arrays can be
+// freed. It returns the number of samples dropped.
+func (t *target) dropOldest() int {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    n := len(t.times) / 2
+    if len(t.times)-n < memoryKeepSamples {
+        n = len(t.times) - memoryKeepSamples
+    }
+    if n <= 0 {
+        return 0
+    }
+    t.times = append([]float64(nil), t.times[n:]...)
+    t.pings = append([]int(nil), t.pings[n:]...)
+    t.stamps = append([]time.Time(nil), t.stamps[n:]...)
+    if r := t.running; r != nil && len(r.replies) > memoryKeepSamples {
+        r.replies = append([]float64(nil), r.replies[len(r.replies)/2:]...)
+    }
+    return n
+}
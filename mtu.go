@@ -0,0 +1,159 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+const (
+    // mtuSmallPayload is the payload of the small probes -mtu-check sends
+    // next to the -s ones, the ping default that gets through any path.
+    mtuSmallPayload = 56
+    // mtuLossStreak is how many large probes in a row must be lost, while
+    // small ones are answered, before a black hole is suspected.
+    mtuLossStreak = 10
+    // mtuSearchProbes is the number of probes sent for every size tried
+    // when looking for the largest payload that gets through.
+    mtuSearchProbes = 2
+)
+
+// mtuCheck watches a target for an MTU black hole with -mtu-check: the
+// large -s probes vanish while small probes, sent alongside once a second,
+// are answered. Both are sent with DF set. Once suspected, the largest
+// payload that still gets through is searched for.
+type mtuCheck struct {
+    t        *target
+    ctx      context.Context
+    opts     pinger.Options // of the small probes
+    large    int            // -s payload
+    ipHeader int
+
+    mutex        sync.Mutex
+    streak       int // large probes lost in a row
+    smallReplies int // small replies during the streak
+    searching    bool
+    verdict      string // the diagnosis, empty while nothing is suspected
+}
+
+// newMTUCheck registers the check as an observer of t. The small probes
+// use opts, with their own echo identifier.
+func newMTUCheck(ctx context.Context, t *target, opts pinger.Options) *mtuCheck {
+    large := opts.PayloadSize
+    opts.Addr = t.addr
+    opts.IPv6 = t.useIPv6
+    opts.ID = (t.id + 0x8000) & 0xffff
+    opts.PayloadSize = mtuSmallPayload
+    opts.BufSize = 0
+    opts.Count = 0
+    opts.DontFragment = true
+    opts.PayloadCheck = pinger.CheckNone
+    if opts.Interval < time.Second {
+        opts.Interval = time.Second
+    }
+    ipHeader := 20
+    if t.useIPv6 {
+        ipHeader = 40
+    }
+    c := &mtuCheck{t: t, ctx: ctx, opts: opts, large: large, ipHeader: ipHeader}
+    t.mtu = c
+    t.observers = append(t.observers, c.observe)
+    return c
+}
+
+// run sends the small probes until the context is done.
+func (c *mtuCheck) run() {
+    err := pinger.New(c.opts).Run(c.ctx, func(r pinger.Result) {
+        if r.Status != pinger.StatusReply {
+            return
+        }
+        c.mutex.Lock()
+        c.smallReplies++
+        c.mutex.Unlock()
+    })
+    if err != nil {
+        diag.Printf("Error sending the small -mtu-check probes to %s: %v\n", c.t.addr, err)
+    }
+}
+
+// observe follows the large probes.
+func (c *mtuCheck) observe(t *target, s sample) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    if !s.Lost {
+        if c.verdict != "" && !c.searching {
+            diag.Printf("Large probes to %s are answered again\n", t.addr)
+            c.verdict = ""
+        }
+        c.streak = 0
+        c.smallReplies = 0
+        return
+    }
+    c.streak++
+    if c.streak >= mtuLossStreak && c.smallReplies > 0 && c.verdict == "" && !c.searching {
+        c.searching = true
+        go c.search(s.Seq)
+    }
+}
+
+// search bisects the payload size between the small probes, which get
+// through, and the -s probes, which do not.
+func (c *mtuCheck) search(seq int) {
+    through, lost := mtuSmallPayload, c.large
+    for lost-through > 1 && c.ctx.Err() == nil {
+        size := (through + lost) / 2
+        if c.gotThrough(size) {
+            through = size
+        } else {
+            lost = size
+        }
+    }
+
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.searching = false
+    if c.ctx.Err() != nil {
+        return
+    }
+    if through >= c.large-1 {
+        // Even the largest size tried got through, the losses had another
+        // cause.
+        diag.Printf("Probe %d to %s: large probes were lost but the MTU search found no limit\n", seq, c.t.addr)
+        c.streak = 0
+        c.smallReplies = 0
+        return
+    }
+    c.verdict = fmt.Sprintf("possible MTU black hole, %d B probes lost while %d B pass, try MTU ≤ %d",
+        c.large, through, through+pinger.ICMPHeaderSize+c.ipHeader)
+    diag.Printf("Probe %d to %s: %s\n", seq, c.t.addr, c.verdict)
+}
+
+// gotThrough reports whether a probe with the given payload is answered.
+func (c *mtuCheck) gotThrough(size int) bool {
+    opts := c.opts
+    opts.PayloadSize = size
+    opts.Count = mtuSearchProbes
+    opts.Interval = 100 * time.Millisecond
+    opts.ID = (c.opts.ID + 1) & 0xffff
+    opts.Logf = nil
+    answered := false
+    pinger.New(opts).Run(c.ctx, func(r pinger.Result) {
+        if r.Status == pinger.StatusReply {
+            answered = true
+        }
+    })
+    return answered
+}
+
+// status is the diagnosis for the stats, empty if there is none.
+func (c *mtuCheck) status() string {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    if c.searching {
+        return "large probes lost while small ones pass, searching the largest size through"
+    }
+    return c.verdict
+}
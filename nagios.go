@@ -0,0 +1,89 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Nagios plugin exit codes.
+const (
+    nagiosOK       = 0
+    nagiosWarning  = 1
+    nagiosCritical = 2
+    nagiosUnknown  = 3
+)
+
+var nagiosStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// nagiosDefaultCount is the number of probes of a -nagios check without -n.
+const nagiosDefaultCount = 5
+
+// threshold is a -warn or -crit limit. A zero field is not checked.
+type threshold struct {
+    rtt  float64 // average RTT in ms
+    loss float64 // loss in percent
+}
+
+// parseThreshold parses "RTT[,LOSS%]", e.g. "100,20%" or "100", in the style
+// of check_ping. An empty value disables the threshold.
+func parseThreshold(value string) (threshold, error) {
+    var th threshold
+    if value == "" {
+        return th, nil
+    }
+    rtt, loss, hasLoss := strings.Cut(value, ",")
+    var err error
+    if th.rtt, err = strconv.ParseFloat(strings.TrimSpace(rtt), 64); err != nil || th.rtt < 0 {
+        return th, fmt.Errorf("invalid RTT %q in %q", rtt, value)
+    }
+    if hasLoss {
+        loss = strings.TrimSuffix(strings.TrimSpace(loss), "%")
+        if th.loss, err = strconv.ParseFloat(loss, 64); err != nil || th.loss < 0 || th.loss > 100 {
+            return th, fmt.Errorf("invalid loss percentage %q in %q", loss, value)
+        }
+    }
+    return th, nil
+}
+
+// exceeded reports whether st is beyond the threshold.
+func (th threshold) exceeded(st Stats) bool {
+    if th.rtt > 0 && (st.Valid == 0 || st.Avg > th.rtt) {
+        return true
+    }
+    return th.loss > 0 && st.PctLost > th.loss
+}
+
+// nagiosCheck prints the result of a -nagios check as a single plugin output
+// line with performance data and returns the plugin exit code, the worst
+// status of all targets.
+func nagiosCheck(warn, crit threshold, targets []*target, stats []Stats) int {
+    status := nagiosOK
+    var texts, perfData []string
+    for i, t := range targets {
+        st := stats[i]
+        targetStatus := nagiosOK
+        switch {
+        case crit.exceeded(st):
+            targetStatus = nagiosCritical
+        case warn.exceeded(st):
+            targetStatus = nagiosWarning
+        }
+        if targetStatus > status {
+            status = targetStatus
+        }
+
+        prefix := ""
+        label := ""
+        if len(targets) > 1 {
+            prefix = t.name() + ": "
+            label = t.addr + "_"
+        }
+        texts = append(texts, fmt.Sprintf("%sPacket loss = %.0f%%, RTA = %.2f ms", prefix, st.PctLost, st.Avg))
+        perfData = append(perfData,
+            fmt.Sprintf("'%srta'=%.6fms;%.6f;%.6f;0.000000", label, st.Avg, warn.rtt, crit.rtt),
+            fmt.Sprintf("'%spl'=%.0f%%;%.0f;%.0f;0;100", label, st.PctLost, warn.loss, crit.loss))
+    }
+    fmt.Printf("PING %s - %s|%s\n", nagiosStatusNames[status], strings.Join(texts, "; "), strings.Join(perfData, " "))
+    return status
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+    "sync"
+    "time"
+)
+
+// note is a timestamped remark about the session, from -note or typed in
+// the graph view with 'n'.
+type note struct {
+    Time time.Time
+    Text string
+}
+
+// noteLog collects the notes of the session and passes every new one to
+// the outputs that record them.
+type noteLog struct {
+    mutex    sync.Mutex
+    notes    []note
+    handlers []func(n note)
+}
+
+// add records a note and hands it to the handlers. The note is logged with
+// the diagnostics as well, so -log keeps it.
+func (l *noteLog) add(n note) {
+    l.mutex.Lock()
+    l.notes = append(l.notes, n)
+    handlers := l.handlers
+    l.mutex.Unlock()
+
+    diag.Printf("Note: %s\n", n.Text)
+    for _, handle := range handlers {
+        handle(n)
+    }
+}
+
+// all returns a copy of the notes, oldest first.
+func (l *noteLog) all() []note {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    return append([]note(nil), l.notes...)
+}
+
+// onNote registers a handler for the notes added from now on.
+func (l *noteLog) onNote(handle func(n note)) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+    l.handlers = append(l.handlers, handle)
+}
+
+// splitNotes separates the notes of an export file from its samples.
+func splitNotes(records []exportRecord) ([]exportRecord, []note) {
+    var samples []exportRecord
+    var notes []note
+    for _, record := range records {
+        if record.Status == exportNoteStatus {
+            notes = append(notes, note{Time: record.Time, Text: record.Note})
+            continue
+        }
+        samples = append(samples, record)
+    }
+    return samples, notes
+}
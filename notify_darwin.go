@@ -0,0 +1,18 @@
+//go:build darwin
+
+package main
+
+import (
+    "os/exec"
+    "strings"
+)
+
+const desktopNotifySupported = true
+
+// desktopNotify shows a notification through the AppleScript notification
+// center bridge.
+func desktopNotify(title, body string) error {
+    quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+    script := `display notification "` + quote.Replace(body) + `" with title "` + quote.Replace(title) + `"`
+    return exec.Command("osascript", "-e", script).Run()
+}
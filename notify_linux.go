@@ -0,0 +1,13 @@
+//go:build linux
+
+package main
+
+import "os/exec"
+
+const desktopNotifySupported = true
+
+// desktopNotify shows a desktop notification through notify-send, which
+// ships with libnotify on most desktops.
+func desktopNotify(title, body string) error {
+    return exec.Command("notify-send", "--app-name=pingGraphGo", title, body).Run()
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+const desktopNotifySupported = false
+
+// desktopNotify is not implemented on this platform.
+func desktopNotify(title, body string) error {
+    return errors.New("desktop notifications are only supported on Linux and macOS")
+}
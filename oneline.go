@@ -0,0 +1,67 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/signal"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// runOneline prints a single status line with the key numbers of every
+// target and rewrites it in place every cfg.refresh, for use in a small
+// terminal split or a status bar. Alerts are checked like in the graph view.
+func runOneline(cfg *config, targets []*target, alertHandlers []alertHandler, startTime time.Time, running *bool) {
+    ticker := time.NewTicker(cfg.refresh)
+    defer ticker.Stop()
+
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+    for *running {
+        select {
+        case <-sigs:
+            *running = false
+        case <-ticker.C:
+            parts := make([]string, len(targets))
+            for i, t := range targets {
+                t.mutex.Lock()
+                checkAlerts(t, cfg, alertHandlers)
+                parts[i] = onelineStatus(t, computeStats(t, cfg, startTime), cfg)
+                t.mutex.Unlock()
+            }
+            // \033[K clears what is left of a previous, longer line
+            fmt.Printf("\r%s\033[K", strings.Join(parts, " | "))
+        }
+    }
+    fmt.Println()
+}
+
+// onelineStatus formats the status of one target as
+// "host UP last 12ms↑ avg 14.1ms loss 0.0% jit 2.3ms", with "med" instead of
+// "avg" for -central median. t.mutex must be held.
+func onelineStatus(t *target, st Stats, cfg *config) string {
+    last := "-"
+    if len(t.times) > 0 {
+        if v := t.times[len(t.times)-1]; v == cfg.deadTimeout {
+            last = "lost"
+        } else {
+            last = fmt.Sprintf("%.0fms", v)
+        }
+    }
+    switch st.Trend {
+    case 1:
+        last += "↑"
+    case -1:
+        last += "↓"
+    }
+    central := "avg"
+    if cfg.central == "median" {
+        central = "med"
+    }
+    if st.Valid == 0 {
+        return fmt.Sprintf("%s %s last %s %s n/a loss %.1f%% jit n/a", t.name(), st.State, last, central, st.PctLost)
+    }
+    return fmt.Sprintf("%s %s last %s %s %.1fms loss %.1f%% jit %.1fms", t.name(), st.State, last, central, st.typical(cfg.central), st.PctLost, st.Jitter)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "time"
+
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+    "go.opentelemetry.io/otel/metric"
+    sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+    "go.opentelemetry.io/otel/sdk/resource"
+    semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// otlpRTTBuckets are the bucket boundaries of the ping.rtt histogram in ms,
+// from a LAN to a satellite link.
+var otlpRTTBuckets = []float64{0.5, 1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000}
+
+// otlpExporter pushes RTT and loss metrics to an OpenTelemetry collector
+// with the OTel SDK: every sample is recorded by observe, and a periodic
+// reader exports the cumulative probe and loss counts and the RTT
+// histogram over OTLP/HTTP every interval. The SDK retries a failed export
+// with backoff and reports errors, which go to the diagnostics.
+type otlpExporter struct {
+    provider *sdkmetric.MeterProvider
+    probes   metric.Int64Counter
+    lost     metric.Int64Counter
+    rtt      metric.Float64Histogram
+}
+
+// newOTLPExporter validates the -otlp endpoint and starts the periodic
+// export. A URL without a path gets the standard /v1/metrics path appended.
+func newOTLPExporter(rawURL string, interval time.Duration) (*otlpExporter, error) {
+    endpoint, err := url.Parse(rawURL)
+    if err != nil {
+        return nil, err
+    }
+    if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+        return nil, fmt.Errorf("unsupported OTLP URL scheme %q (want http or https)", endpoint.Scheme)
+    }
+    if endpoint.Host == "" {
+        return nil, fmt.Errorf("OTLP URL %q has no host", rawURL)
+    }
+    if endpoint.Path == "" || endpoint.Path == "/" {
+        endpoint.Path = "/v1/metrics"
+    }
+
+    exporter, err := otlpmetrichttp.New(context.Background(), otlpmetrichttp.WithEndpointURL(endpoint.String()))
+    if err != nil {
+        return nil, err
+    }
+    otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+        diag.Printf("Error exporting OTLP metrics: %v\n", err)
+    }))
+    provider := sdkmetric.NewMeterProvider(
+        sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+        sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceName("pingGraphGo"))),
+    )
+    meter := provider.Meter("pingGraphGo")
+    e := &otlpExporter{provider: provider}
+    if e.probes, err = meter.Int64Counter("ping.probes", metric.WithUnit("{probe}")); err != nil {
+        return nil, err
+    }
+    if e.lost, err = meter.Int64Counter("ping.lost", metric.WithUnit("{probe}")); err != nil {
+        return nil, err
+    }
+    e.rtt, err = meter.Float64Histogram("ping.rtt", metric.WithUnit("ms"), metric.WithExplicitBucketBoundaries(otlpRTTBuckets...))
+    if err != nil {
+        return nil, err
+    }
+    return e, nil
+}
+
+func (e *otlpExporter) observe(t *target, s sample) {
+    ctx := context.Background()
+    attributes := metric.WithAttributes(attribute.String("host", t.host), attribute.String("addr", t.addr))
+    e.probes.Add(ctx, 1, attributes)
+    if s.Lost {
+        e.lost.Add(ctx, 1, attributes)
+        return
+    }
+    e.rtt.Record(ctx, s.RTT, attributes)
+}
+
+// flush exports what was recorded since the last export.
+func (e *otlpExporter) flush() {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+    if err := e.provider.ForceFlush(ctx); err != nil {
+        diag.Printf("Error exporting OTLP metrics: %v\n", err)
+    }
+}
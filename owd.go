@@ -0,0 +1,156 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "sync"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+const (
+    // owdGiveUp is how many timestamp requests may go unanswered before
+    // the target is reported as not answering them.
+    owdGiveUp = 10
+    // owdWindow is the number of recent one-way delays the queueing delay
+    // is measured against. The clocks of the two hosts drift apart, so a
+    // minimum over the whole run would slowly go stale.
+    owdWindow = 60
+)
+
+// owdCheck measures the one-way delay variation of a target with -owd.
+// ICMP timestamp requests, sent alongside the echo requests, come back
+// with the time the target received the request and sent the reply. The
+// one-way delays include the unknown offset between the two clocks, which
+// drops out of their differences: the jitter of each direction, and the
+// latest delay above the lowest of the recent ones, which shows on which
+// way queues build up.
+type owdCheck struct {
+    t    *target
+    ctx  context.Context
+    opts pinger.Options
+
+    mutex       sync.Mutex
+    sent        int
+    replies     int
+    nonStandard int
+    forward     owdDirection
+    back        owdDirection
+}
+
+// owdDirection follows the delays of one direction.
+type owdDirection struct {
+    recent   []float64 // ms, the last owdWindow delays
+    sumDiffs float64
+    pairs    int
+}
+
+func (d *owdDirection) add(delay time.Duration) {
+    ms := float64(delay) / float64(time.Millisecond)
+    if n := len(d.recent); n > 0 {
+        d.sumDiffs += math.Abs(ms - d.recent[n-1])
+        d.pairs++
+    }
+    d.recent = append(d.recent, ms)
+    if len(d.recent) > owdWindow {
+        d.recent = append(d.recent[:0], d.recent[1:]...)
+    }
+}
+
+// jitter is the mean absolute difference between consecutive delays.
+func (d *owdDirection) jitter() float64 {
+    if d.pairs == 0 {
+        return 0
+    }
+    return d.sumDiffs / float64(d.pairs)
+}
+
+// queueing is how far the latest delay is above the lowest recent one.
+func (d *owdDirection) queueing() float64 {
+    lowest := d.recent[0]
+    for _, v := range d.recent {
+        lowest = min(lowest, v)
+    }
+    return d.recent[len(d.recent)-1] - lowest
+}
+
+func (d *owdDirection) format() string {
+    return fmt.Sprintf("jitter %.2f ms (+%.0f ms queued)", d.jitter(), d.queueing())
+}
+
+// newOWDCheck attaches the check to t. The timestamp requests use opts,
+// with their own identifier and at most one a second, until ctx is done.
+func newOWDCheck(ctx context.Context, t *target, opts pinger.Options) *owdCheck {
+    opts.Addr = t.addr
+    opts.IPv6 = t.useIPv6
+    opts.ID = (t.id + 0x4000) & 0xffff
+    opts.Timestamp = true
+    opts.PayloadSize = 0
+    opts.BufSize = 0
+    opts.Count = 0
+    opts.Broadcast = false
+    opts.PayloadCheck = pinger.CheckNone
+    opts.Raw = false
+    if opts.Interval < time.Second {
+        opts.Interval = time.Second
+    }
+    c := &owdCheck{t: t, ctx: ctx, opts: opts}
+    t.owd = c
+    return c
+}
+
+// run sends the timestamp requests until the context is done. IPv6 has
+// none, so there is nothing to do for IPv6 targets.
+func (c *owdCheck) run() {
+    if c.opts.IPv6 {
+        return
+    }
+    err := pinger.New(c.opts).Run(c.ctx, func(r pinger.Result) {
+        c.mutex.Lock()
+        defer c.mutex.Unlock()
+        c.sent++
+        switch {
+        case r.Status != pinger.StatusReply:
+        case r.NonStandardTime:
+            c.replies++
+            c.nonStandard++
+        default:
+            c.replies++
+            c.forward.add(r.Forward)
+            c.back.add(r.Return)
+        }
+    })
+    if err != nil {
+        diag.Printf("Error sending the -owd timestamp requests to %s: %v\n", c.t.addr, err)
+    }
+}
+
+// reset forgets the delays measured so far.
+func (c *owdCheck) reset() {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.sent, c.replies, c.nonStandard = 0, 0, 0
+    c.forward = owdDirection{}
+    c.back = owdDirection{}
+}
+
+// status renders the one-way delay variation for the stats, or why there
+// is none.
+func (c *owdCheck) status() string {
+    if c.opts.IPv6 {
+        return "not available, ICMP timestamps are IPv4 only"
+    }
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    switch {
+    case c.replies == 0 && c.sent >= owdGiveUp:
+        return fmt.Sprintf("not supported, %d timestamp requests unanswered", c.sent)
+    case c.replies > 0 && c.nonStandard == c.replies:
+        return "not supported, the target clock is not in UTC milliseconds"
+    case len(c.forward.recent) == 0:
+        return "waiting for timestamp replies"
+    }
+    return fmt.Sprintf("fwd %s / ret %s", c.forward.format(), c.back.format())
+}
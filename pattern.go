@@ -0,0 +1,58 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// parsePattern parses a -pattern value such as "5x50ms,1s": bursts of N
+// probes D apart written as NxD, each optionally followed by the idle time
+// until the next burst. Without an idle time the next burst follows after
+// D. The result are the gaps between the probes of one cycle.
+func parsePattern(value string) ([]time.Duration, error) {
+    var gaps []time.Duration
+    idle := false // the last burst already has its idle time
+    for _, item := range strings.Split(value, ",") {
+        item = strings.TrimSpace(item)
+        count, spacing, isBurst := strings.Cut(item, "x")
+        if !isBurst {
+            d, err := time.ParseDuration(item)
+            if err != nil {
+                return nil, fmt.Errorf("%q is neither a burst (NxDURATION) nor an idle time", item)
+            }
+            if d <= 0 {
+                return nil, fmt.Errorf("idle time %q must be positive", item)
+            }
+            if len(gaps) == 0 || idle {
+                return nil, fmt.Errorf("idle time %q does not follow a burst", item)
+            }
+            gaps[len(gaps)-1] = d
+            idle = true
+            continue
+        }
+        n, err := strconv.Atoi(count)
+        if err != nil || n < 1 {
+            return nil, fmt.Errorf("burst %q needs a probe count of at least 1", item)
+        }
+        d, err := time.ParseDuration(spacing)
+        if err != nil || d <= 0 {
+            return nil, fmt.Errorf("burst %q needs a positive spacing", item)
+        }
+        for i := 0; i < n; i++ {
+            gaps = append(gaps, d)
+        }
+        idle = false
+    }
+    return gaps, nil
+}
+
+// patternPeriod returns the mean time between two probes of a pattern.
+func patternPeriod(gaps []time.Duration) time.Duration {
+    var sum time.Duration
+    for _, gap := range gaps {
+        sum += gap
+    }
+    return sum / time.Duration(len(gaps))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "time"
+)
+
+const (
+    // periodSamples is how many of the latest samples the autocorrelation
+    // looks at, which bounds its cost.
+    periodSamples = 2048
+    // periodMinSamples is the number of samples needed before a period is
+    // looked for.
+    periodMinSamples = 60
+    // periodMinCorrelation is the autocorrelation a repeating pattern must
+    // reach to be reported.
+    periodMinCorrelation = 0.3
+    // periodRefresh is how often the period is searched again, the search
+    // is too slow for every refresh.
+    periodRefresh = 10 * time.Second
+)
+
+// periodHint is the dominant period of the latency of a target, cached on
+// the target between searches.
+type periodHint struct {
+    at          time.Time // when it was last searched, zero to search again
+    period      time.Duration // 0 if nothing stands out
+    correlation float64
+}
+
+// latencyPeriod returns the dominant period of the latest samples of t,
+// searching again every periodRefresh. t.mutex must be held.
+func latencyPeriod(t *target, deadTimeout float64) periodHint {
+    if !t.period.at.IsZero() && time.Since(t.period.at) < periodRefresh {
+        return t.period
+    }
+    t.period = periodHint{at: time.Now()}
+    start := max(0, len(t.times)-periodSamples)
+    samples := t.times[start:]
+    if len(samples) < periodMinSamples {
+        return t.period
+    }
+    // Lost probes stay in at the -D value, so periodic loss shows as well.
+    lag, correlation, ok := dominantLag(samples, periodMinCorrelation)
+    if !ok {
+        return t.period
+    }
+    stamps := t.stamps[start:]
+    spacing := stamps[len(stamps)-1].Sub(stamps[0]) / time.Duration(len(stamps)-1)
+    t.period.period = spacing * time.Duration(lag)
+    t.period.correlation = correlation
+    return t.period
+}
+
+// dominantLag returns the lag in samples at which the series repeats: the
+// shortest lag at a peak of its autocorrelation about as high as the
+// highest one, once the correlation of neighbouring samples has decayed.
+// Lags go up to a third of the series so the pattern is seen at least
+// three times. ok is false if no peak reaches minCorrelation or the series
+// is flat.
+func dominantLag(series []float64, minCorrelation float64) (lag int, correlation float64, ok bool) {
+    n := len(series)
+    mean := 0.0
+    for _, v := range series {
+        mean += v
+    }
+    mean /= float64(n)
+    centered := make([]float64, n)
+    variance := 0.0
+    for i, v := range series {
+        centered[i] = v - mean
+        variance += centered[i] * centered[i]
+    }
+    if variance == 0 {
+        return 0, 0, false
+    }
+
+    maxLag := n / 3
+    r := make([]float64, maxLag+2)
+    for k := 1; k < len(r); k++ {
+        sum := 0.0
+        for i := 0; i+k < n; i++ {
+            sum += centered[i] * centered[i+k]
+        }
+        // Scaled to the overlap, so long lags are not penalized.
+        r[k] = sum / variance * float64(n) / float64(n-k)
+    }
+
+    // Skip the lags at which the samples are still correlated with their
+    // neighbours, up to the first minimum.
+    first := 1
+    for first+1 < len(r) && r[first+1] < r[first] {
+        first++
+    }
+    var peaks []int
+    best := 0.0
+    for k := max(first, 2); k <= maxLag; k++ {
+        if r[k] >= r[k-1] && r[k] >= r[k+1] {
+            peaks = append(peaks, k)
+            best = math.Max(best, r[k])
+        }
+    }
+    if best < minCorrelation {
+        return 0, 0, false
+    }
+    // Multiples of the period correlate about as well as the period
+    // itself, the shortest lag close to the best one is the period.
+    for _, k := range peaks {
+        if r[k] >= best*0.9 {
+            return k, r[k], true
+        }
+    }
+    return 0, 0, false
+}
+
+// formatPeriod renders the period hint for the stats panel, empty if no
+// period stands out.
+func formatPeriod(hint periodHint) string {
+    if hint.period == 0 {
+        return ""
+    }
+    return fmt.Sprintf("[Latency repeats ~every %s (r=%.2f)](fg:yellow)\n", formatPeriodDuration(hint.period), hint.correlation)
+}
+
+// formatPeriodDuration rounds a period to what the sampling can tell.
+func formatPeriodDuration(d time.Duration) string {
+    switch {
+    case d >= time.Minute:
+        return d.Round(time.Second).String()
+    case d >= time.Second:
+        return d.Round(100 * time.Millisecond).String()
+    }
+    return d.Round(time.Millisecond).String()
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package pinger
+
+import (
+    "errors"
+    "net"
+)
+
+// enableBroadcast is not implemented on this platform.
+func enableBroadcast(conn *net.IPConn) error {
+    return errors.New("not supported on this platform")
+}
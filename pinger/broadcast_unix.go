@@ -0,0 +1,25 @@
+//go:build unix
+
+package pinger
+
+import (
+    "net"
+
+    "golang.org/x/sys/unix"
+)
+
+// enableBroadcast allows sending to broadcast addresses on conn.
+func enableBroadcast(conn *net.IPConn) error {
+    raw, err := conn.SyscallConn()
+    if err != nil {
+        return err
+    }
+    var sockErr error
+    err = raw.Control(func(fd uintptr) {
+        sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1)
+    })
+    if err != nil {
+        return err
+    }
+    return sockErr
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package pinger
+
+import (
+    "net"
+    "syscall"
+)
+
+// enableBroadcast allows sending to broadcast addresses on conn.
+func enableBroadcast(conn *net.IPConn) error {
+    raw, err := conn.SyscallConn()
+    if err != nil {
+        return err
+    }
+    var sockErr error
+    err = raw.Control(func(fd uintptr) {
+        sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1)
+    })
+    if err != nil {
+        return err
+    }
+    return sockErr
+}
@@ -0,0 +1,29 @@
+package pinger
+
+import (
+    "net"
+
+    "golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the DF bit on IPv4 requests and keeps IPv6 requests
+// from being fragmented by the sending host. Requests larger than the path
+// MTU known to the kernel then fail with EMSGSIZE instead of being split.
+func setDontFragment(conn *net.IPConn, isIPv6 bool) error {
+    rawConn, err := conn.SyscallConn()
+    if err != nil {
+        return err
+    }
+    var sockErr error
+    err = rawConn.Control(func(fd uintptr) {
+        if isIPv6 {
+            sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO)
+            return
+        }
+        sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO)
+    })
+    if err != nil {
+        return err
+    }
+    return sockErr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pinger
+
+import (
+    "errors"
+    "net"
+)
+
+// setDontFragment is only implemented on Linux.
+func setDontFragment(conn *net.IPConn, isIPv6 bool) error {
+    return errors.New("not supported on this platform")
+}
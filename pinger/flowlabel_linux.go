@@ -0,0 +1,99 @@
+package pinger
+
+import (
+    "encoding/binary"
+    "net"
+    "unsafe"
+
+    "golang.org/x/sys/unix"
+)
+
+// Flow label socket options from linux/in6.h, not exported by x/sys/unix.
+const (
+    ipv6FlowLabelMgr = 32
+    ipv6FlowInfoSend = 33
+
+    ipv6FlActionGet  = 0
+    ipv6FlShareExcl  = 1
+    ipv6FlFlagCreate = 1
+)
+
+// in6FlowLabelReq mirrors struct in6_flowlabel_req.
+type in6FlowLabelReq struct {
+    dst     [16]byte
+    label   uint32 // network byte order
+    action  uint8
+    share   uint8
+    flags   uint16
+    expires uint16
+    linger  uint16
+    pad     uint32
+}
+
+// flowLabelSender leases the flow label for dst on the socket and returns a
+// send function that puts it on every packet. Linux only accepts flow labels
+// in sendto() that the socket holds a lease for, and the label travels in
+// sin6_flowinfo, which the net package cannot set.
+func flowLabelSender(conn *net.IPConn, dst net.IP, label uint32) (func(b []byte) (int, error), error) {
+    rawConn, err := conn.SyscallConn()
+    if err != nil {
+        return nil, err
+    }
+
+    var bigEndianLabel [4]byte
+    binary.BigEndian.PutUint32(bigEndianLabel[:], label)
+    req := in6FlowLabelReq{
+        label:  *(*uint32)(unsafe.Pointer(&bigEndianLabel)),
+        action: ipv6FlActionGet,
+        share:  ipv6FlShareExcl,
+        flags:  ipv6FlFlagCreate,
+    }
+    copy(req.dst[:], dst.To16())
+
+    var sockErr error
+    err = rawConn.Control(func(fd uintptr) {
+        _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, fd, unix.IPPROTO_IPV6, ipv6FlowLabelMgr,
+            uintptr(unsafe.Pointer(&req)), unsafe.Sizeof(req), 0)
+        if errno != 0 {
+            sockErr = errno
+            return
+        }
+        sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, ipv6FlowInfoSend, 1)
+    })
+    if err != nil {
+        return nil, err
+    }
+    if sockErr != nil {
+        return nil, sockErr
+    }
+
+    sa := unix.RawSockaddrInet6{
+        Family:   unix.AF_INET6,
+        Flowinfo: req.label,
+    }
+    copy(sa.Addr[:], dst.To16())
+
+    return func(b []byte) (int, error) {
+        var n uintptr
+        var sendErr error
+        err := rawConn.Write(func(fd uintptr) bool {
+            var errno unix.Errno
+            n, _, errno = unix.Syscall6(unix.SYS_SENDTO, fd, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), 0,
+                uintptr(unsafe.Pointer(&sa)), unix.SizeofSockaddrInet6)
+            if errno == unix.EAGAIN {
+                return false
+            }
+            if errno != 0 {
+                sendErr = errno
+            }
+            return true
+        })
+        if err != nil {
+            return 0, err
+        }
+        if sendErr != nil {
+            return 0, sendErr
+        }
+        return int(n), nil
+    }, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pinger
+
+import (
+    "errors"
+    "net"
+)
+
+// flowLabelSender is only implemented on Linux.
+func flowLabelSender(conn *net.IPConn, dst net.IP, label uint32) (func(b []byte) (int, error), error) {
+    return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,68 @@
+package pinger
+
+import (
+    "encoding/binary"
+    "time"
+)
+
+const (
+    // timestampBodySize is the body of an ICMP timestamp message after the
+    // type, code and checksum: ID, Seq and three 32 bit timestamps.
+    timestampBodySize = 16
+    // nonStandardTime is the high bit RFC 792 sets in a timestamp that is
+    // not in milliseconds since midnight UTC.
+    nonStandardTime = 1 << 31
+    // msPerDay is where the timestamps wrap around.
+    msPerDay = 24 * 60 * 60 * 1000
+)
+
+// msOfDay returns t as an ICMP timestamp, milliseconds since midnight UTC.
+func msOfDay(t time.Time) uint32 {
+    t = t.UTC()
+    midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+    return uint32(t.Sub(midnight).Milliseconds())
+}
+
+// timestampBody returns the body of a timestamp request with the
+// originate timestamp of sent. The target fills in the other two.
+func timestampBody(id, wireSeq int, sent time.Time) []byte {
+    b := make([]byte, timestampBodySize)
+    binary.BigEndian.PutUint16(b[0:], uint16(id))
+    binary.BigEndian.PutUint16(b[2:], uint16(wireSeq))
+    binary.BigEndian.PutUint32(b[4:], msOfDay(sent))
+    return b
+}
+
+// timestampReply holds the fields of a timestamp reply.
+type timestampReply struct {
+    id, seq                      int
+    originate, receive, transmit uint32
+}
+
+// parseTimestampReply decodes the body of a timestamp reply.
+func parseTimestampReply(data []byte) (timestampReply, bool) {
+    if len(data) < timestampBodySize {
+        return timestampReply{}, false
+    }
+    return timestampReply{
+        id:        int(binary.BigEndian.Uint16(data[0:])),
+        seq:       int(binary.BigEndian.Uint16(data[2:])),
+        originate: binary.BigEndian.Uint32(data[4:]),
+        receive:   binary.BigEndian.Uint32(data[8:]),
+        transmit:  binary.BigEndian.Uint32(data[12:]),
+    }, true
+}
+
+// oneWay returns the time from the timestamp from to the timestamp to,
+// taken on two different clocks. Around midnight one of them may already
+// have wrapped, so the result is kept within half a day either way.
+func oneWay(from, to uint32) time.Duration {
+    d := (int64(to) - int64(from)) % msPerDay
+    switch {
+    case d > msPerDay/2:
+        d -= msPerDay
+    case d < -msPerDay/2:
+        d += msPerDay
+    }
+    return time.Duration(d) * time.Millisecond
+}
@@ -0,0 +1,117 @@
+package pinger
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "hash/crc32"
+    "strings"
+)
+
+// PayloadCheck selects how the payload of echo replies is verified.
+type PayloadCheck int
+
+const (
+    CheckNone PayloadCheck = iota // the payload is not verified
+    CheckFull                     // the payload is compared byte by byte
+    CheckHash                     // a CRC-32C of sampled spans, embedded in the payload, is verified
+)
+
+// HashSize is the number of payload bytes CheckHash uses for the checksum.
+const HashSize = 4
+
+const (
+    // hashSpans and hashSpanSize are the spans of the payload CheckHash
+    // covers, spread evenly from its start to its end, so that verifying a
+    // reply costs the same for any payload size.
+    hashSpans    = 4
+    hashSpanSize = 64
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (c PayloadCheck) String() string {
+    switch c {
+    case CheckNone:
+        return "none"
+    case CheckFull:
+        return "full"
+    case CheckHash:
+        return "hash"
+    }
+    return fmt.Sprintf("check %d", int(c))
+}
+
+// ParsePayloadCheck parses the name of a payload check as printed by
+// String.
+func ParsePayloadCheck(name string) (PayloadCheck, error) {
+    switch strings.ToLower(name) {
+    case "none", "":
+        return CheckNone, nil
+    case "full":
+        return CheckFull, nil
+    case "hash", "crc":
+        return CheckHash, nil
+    }
+    return CheckNone, fmt.Errorf("unknown payload check %q, use none, full or hash", name)
+}
+
+// probeHash is the checksum CheckHash embeds in the request with the given
+// wire sequence number: the CRC-32C of the sampled payload, continued over
+// the sequence number so that every probe carries its own. base is the
+// sampledHash of the payload, which is the same for every probe.
+func probeHash(base uint32, wireSeq int) uint32 {
+    return crc32.Update(base, crcTable, []byte{byte(wireSeq >> 8), byte(wireSeq)})
+}
+
+// sampledHash returns the CRC-32C of the hashSpans spans of the payload
+// after the checksum, or of all of it when it is no longer than them.
+// Corruption between the spans goes unnoticed, which CheckFull is for.
+func sampledHash(payload []byte) uint32 {
+    body := payload[HashSize:]
+    if len(body) <= hashSpans*hashSpanSize {
+        return crc32.Checksum(body, crcTable)
+    }
+    var crc uint32
+    for k := 0; k < hashSpans; k++ {
+        start := k * (len(body) - hashSpanSize) / (hashSpans - 1)
+        crc = crc32.Update(crc, crcTable, body[start:start+hashSpanSize])
+    }
+    return crc
+}
+
+// probeData returns the payload of the request with the given wire
+// sequence number and the checksum it carries, or the shared payload
+// without a checksum when the hash check is off. With the check the
+// payload is p.payload itself with the checksum of the probe written into
+// it: only the sender uses it, and the request is marshaled before the
+// next probe.
+func (p *Pinger) probeData(wireSeq int) ([]byte, uint32) {
+    if p.opts.PayloadCheck != CheckHash {
+        return p.payload, 0
+    }
+    hash := probeHash(p.payloadHash, wireSeq)
+    binary.BigEndian.PutUint32(p.payload, hash)
+    return p.payload, hash
+}
+
+// corrupted reports whether the payload of an echo reply differs from what
+// its probe sent. Truncated payloads cannot be verified and pass.
+func (p *Pinger) corrupted(data []byte, wireSeq int, pr probe) bool {
+    if len(data) < len(p.payload) {
+        return false
+    }
+    data = data[:len(p.payload)]
+    switch p.opts.PayloadCheck {
+    case CheckFull:
+        return !bytes.Equal(data, p.payload)
+    case CheckHash:
+        // The reply must carry the checksum sent with the probe, and the
+        // sampled payload must still add up to it.
+        if binary.BigEndian.Uint32(data) != pr.hash {
+            return true
+        }
+        return probeHash(sampledHash(data), wireSeq) != pr.hash
+    }
+    return false
+}
@@ -0,0 +1,26 @@
+package pinger
+
+import "testing"
+
+func TestCheckHash(t *testing.T) {
+    p := New(Options{PayloadSize: 9000, PayloadCheck: CheckHash})
+    data, hash := p.probeData(3)
+    reply := append([]byte(nil), data...)
+    pr := probe{seq: 3, hash: hash}
+    if p.corrupted(reply, 3, pr) {
+        t.Error("intact payload reported as corrupted")
+    }
+
+    // The last span ends with the payload.
+    reply[len(reply)-1] ^= 1
+    if !p.corrupted(reply, 3, pr) {
+        t.Error("flipped last byte not detected")
+    }
+    reply[len(reply)-1] ^= 1
+
+    // The payload of another probe carries another checksum.
+    other, _ := p.probeData(4)
+    if !p.corrupted(append([]byte(nil), other...), 3, pr) {
+        t.Error("payload of probe 4 accepted for probe 3")
+    }
+}
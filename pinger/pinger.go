@@ -0,0 +1,935 @@
+// Package pinger sends ICMP echo requests to a single address and reports
+// the outcome of every probe. It has no knowledge of the terminal UI or of
+// command-line flags, so it can be embedded in other programs:
+//
+//    p := pinger.New(pinger.Options{Addr: "192.0.2.1", Interval: time.Second, Timeout: time.Second})
+//    err := p.Run(ctx, func(r pinger.Result) {
+//        fmt.Println(r.Seq, r.Status, r.RTT)
+//    })
+//
+// Raw ICMP sockets are used, which require elevated privileges on most
+// systems.
+package pinger
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "golang.org/x/net/icmp"
+    "golang.org/x/net/ipv4"
+    "golang.org/x/net/ipv6"
+)
+
+const (
+    // ICMPHeaderSize is the size of the ICMP echo header preceding the payload.
+    ICMPHeaderSize = 8
+    // MaxIPv4HeaderSize is the IPv4 header size including all options.
+    MaxIPv4HeaderSize = 60
+    // MaxPayloadSize is the largest echo payload that fits an IPv4 packet.
+    MaxPayloadSize = 65535 - 20 - ICMPHeaderSize
+    // SeqMask keeps the probe number within the 16 bit echo sequence field.
+    SeqMask = 0xffff
+)
+
+// Options configures a Pinger.
+type Options struct {
+    Addr        string        // IP address to ping
+    IPv6        bool          // Addr is an IPv6 address
+    ID          int           // ICMP echo identifier, used as is
+    Interval    time.Duration // time between two requests
+    Count       int           // number of requests to send, 0 sends until the context is done
+    Timeout     time.Duration // how long to wait for each reply
+    PayloadSize int           // number of data bytes in each request
+    BufSize     int           // reply read buffer size, 0 derives it from PayloadSize
+    FlowLabel   int           // IPv6 flow label of the requests, 0 leaves it unset (Linux only)
+    Source      string        // local IP address to send from, empty for the one the route picks
+
+    // Schedule lists the times between requests, used in order and
+    // repeated, instead of Interval, for bursts of requests with idle
+    // times in between.
+    Schedule []time.Duration
+
+    // Broadcast enables sending to broadcast addresses and collects every
+    // reply to a probe instead of only the first, as many hosts answer a
+    // broadcast or multicast echo request.
+    Broadcast bool
+
+    // DontFragment forbids fragmenting the requests (the DF bit on IPv4),
+    // so a request larger than the path MTU is dropped or rejected instead
+    // of getting through in pieces. Linux only.
+    DontFragment bool
+
+    // Drain discards the replies already queued on a new socket, from
+    // before the run or a reconnection, instead of blaming unmatched ones
+    // on the oldest probe in flight. Replies to probes in flight are still
+    // matched.
+    Drain bool
+
+    // PayloadCheck verifies the payload of every echo reply and marks the
+    // replies whose payload changed on the way as Corrupted. CheckHash
+    // needs a payload of at least HashSize bytes and only covers a fixed
+    // sample of it, for large payloads.
+    PayloadCheck PayloadCheck
+
+    // KernelTimestamps takes the receive time of replies from the kernel
+    // (SO_TIMESTAMPNS) instead of reading the clock after the reply was
+    // read, for sub-millisecond accuracy. Linux only; elsewhere, or when
+    // the socket refuses, replies are timed in user space.
+    KernelTimestamps bool
+
+    // Timestamp sends ICMP timestamp requests instead of echo requests, so
+    // the replies tell when the target received the request and sent its
+    // answer, see Result.Forward. IPv4 only, there is no payload.
+    Timestamp bool
+
+    // Raw replaces the echo requests with ICMP messages of type RawType,
+    // the echo request type if negative, and code RawCode, for protocol
+    // testing. The body is still an echo
+    // body with ID, Seq and payload. Targets rarely answer those with an
+    // echo reply; whatever else comes back is reported as StatusUnexpected
+    // or StatusParseError, blamed on the oldest probe.
+    Raw     bool
+    RawType int
+    RawCode int
+
+    // Logf receives diagnostics that are not part of any Result. It may be
+    // nil to discard them.
+    Logf func(format string, args ...interface{})
+}
+
+// Status classifies the outcome of a probe.
+type Status int
+
+const (
+    StatusReply      Status = iota // echo reply received
+    StatusTimeout                  // no reply before the timeout
+    StatusSendError                // the request could not be sent
+    StatusRecvError                // reading from the socket failed
+    StatusParseError               // the reply could not be parsed
+    StatusUnexpected               // an ICMP message other than an echo reply arrived
+    StatusUnreachable              // a destination unreachable error answered the probe
+)
+
+func (s Status) String() string {
+    switch s {
+    case StatusReply:
+        return "reply"
+    case StatusTimeout:
+        return "timeout"
+    case StatusSendError:
+        return "send error"
+    case StatusRecvError:
+        return "receive error"
+    case StatusParseError:
+        return "parse error"
+    case StatusUnexpected:
+        return "unexpected reply"
+    case StatusUnreachable:
+        return "unreachable"
+    }
+    return fmt.Sprintf("status %d", int(s))
+}
+
+// Result is the outcome of a single probe.
+type Result struct {
+    Seq    int           // probe number counting from 1, sent as Seq&SeqMask
+    Sent   time.Time     // when the request was sent
+    RTT    time.Duration // round trip time, only meaningful for StatusReply
+    Status Status
+    Peer   net.Addr      // sender of the reply, if any
+
+    // Message is the received ICMP message for StatusReply,
+    // StatusUnexpected and StatusUnreachable.
+    Message *icmp.Message
+
+    // Reason describes why the destination is unreachable, e.g.
+    // "host unreachable" or "admin prohibited", for StatusUnreachable.
+    Reason string
+
+    // Truncated is set when the echo reply carried less payload than was
+    // sent, usually because it did not fit the read buffer.
+    Truncated  bool
+    PayloadLen int // payload bytes in the echo reply
+
+    // TTL is the TTL (IPv4) or hop limit (IPv6) the reply arrived with, 0 if
+    // the platform does not report it.
+    TTL int
+
+    // Duplicate marks a further reply to a probe that already got its
+    // result, from another responder. Only reported with Broadcast.
+    Duplicate bool
+
+    // Corrupted is set when the reply payload differs from the request,
+    // see Options.PayloadCheck.
+    Corrupted bool
+
+    // Reordered marks a reply that arrived after the reply to a probe sent
+    // later, e.g. because the two took different paths.
+    Reordered bool
+
+    // KernelTimestamp is set when RTT was measured against the kernel
+    // receive time, see Options.KernelTimestamps.
+    KernelTimestamp bool
+
+    // Forward and Return are the one-way delays of a timestamp reply, see
+    // Options.Timestamp: from sending the request to the target receiving
+    // it, and from the target sending the reply to its arrival. They are
+    // off by the difference of the two clocks, so only their variation
+    // means something, and have millisecond resolution. NonStandardTime is
+    // set instead when the target marked its timestamps as not being
+    // milliseconds since midnight UTC.
+    Forward         time.Duration
+    Return          time.Duration
+    NonStandardTime bool
+
+    // Raw holds a copy of the received bytes for StatusParseError and
+    // StatusUnexpected, for debugging odd replies.
+    Raw []byte
+
+    Err error // cause of send, receive and parse errors
+}
+
+// MaxFlowLabel is the largest value of the 20 bit IPv6 flow label.
+const MaxFlowLabel = 1<<20 - 1
+
+// Pinger probes one address. Create it with New and start it with Run.
+type Pinger struct {
+    opts        Options
+    payload     []byte
+    payloadHash uint32 // sampledHash of the payload, for CheckHash
+
+    // sock is the ICMP socket in use, replaced by reconnect when it breaks.
+    sockMutex    sync.Mutex
+    sock         *socket
+    reconnecting bool
+    closed       bool // Run is done, no new socket is needed
+    sendErrors   int  // consecutive send errors, only used by the sender
+    lastReplied  int  // highest Seq answered so far, only used by the receiver
+
+    // outstanding holds the probes that were sent but are neither answered
+    // nor timed out yet, by their sequence number on the wire.
+    mutex       sync.Mutex
+    outstanding map[int]probe
+
+    // Pacing of the sender: when the last request went out and how far the
+    // gaps between requests were off the Interval.
+    lastSend  time.Time
+    gaps      int
+    pacingSum time.Duration
+    pacingMax time.Duration
+
+    // Bytes of ICMP messages sent, and received in answer to the probes.
+    sentBytes     atomic.Int64
+    receivedBytes atomic.Int64
+}
+
+// probe is a request waiting for its reply.
+type probe struct {
+    seq     int
+    sent    time.Time
+    hash    uint32 // checksum in the payload, for CheckHash
+    replied bool   // with Broadcast, kept until the timeout to collect more replies
+}
+
+// New returns a Pinger for the given options. No socket is opened until Run.
+func New(opts Options) *Pinger {
+    if opts.BufSize == 0 {
+        opts.BufSize = DefaultBufSize(opts.PayloadSize)
+    }
+    p := &Pinger{
+        opts:        opts,
+        payload:     MakePayload(opts.PayloadSize),
+        outstanding: make(map[int]probe),
+    }
+    if opts.PayloadCheck == CheckHash && len(p.payload) >= HashSize {
+        p.payloadHash = sampledHash(p.payload)
+    }
+    return p
+}
+
+// DefaultBufSize sizes the reply buffer for the echo reply to a probe with
+// the given payload: ICMP header, payload and the largest IPv4 header, which
+// raw IPv4 sockets deliver along with the message. It never goes below a
+// standard Ethernet MTU.
+func DefaultBufSize(payloadSize int) int {
+    size := MaxIPv4HeaderSize + ICMPHeaderSize + payloadSize
+    if size < 1500 {
+        size = 1500
+    }
+    return size
+}
+
+// MakePayload fills a payload of the given size with a repeating marker.
+func MakePayload(size int) []byte {
+    marker := []byte("HELLO-PING")
+    payload := make([]byte, size)
+    for i := range payload {
+        payload[i] = marker[i%len(marker)]
+    }
+    return payload
+}
+
+func (p *Pinger) logf(format string, args ...interface{}) {
+    if p.opts.Logf != nil {
+        p.opts.Logf(format, args...)
+    }
+}
+
+// Outstanding returns the number of probes currently in flight: sent, but
+// neither answered nor timed out. It may be called while Run is active.
+func (p *Pinger) Outstanding() int {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    n := 0
+    for _, pr := range p.outstanding {
+        if !pr.replied {
+            n++
+        }
+    }
+    return n
+}
+
+// Pacing returns the mean and the largest deviation of the time between
+// two requests from Interval, or the Schedule, so far. It may be called while Run is active.
+func (p *Pinger) Pacing() (mean time.Duration, max time.Duration) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    if p.gaps == 0 {
+        return 0, 0
+    }
+    return p.pacingSum / time.Duration(p.gaps), p.pacingMax
+}
+
+// Traffic returns the number of bytes written for the requests and read
+// for the replies and errors answering them so far. It may be called while
+// Run is active.
+func (p *Pinger) Traffic() (sent, received int64) {
+    return p.sentBytes.Load(), p.receivedBytes.Load()
+}
+
+// Run opens the ICMP socket and probes the address until ctx is done, or
+// until Count probes were sent and all of them are resolved, calling fn
+// with the result of every probe. Requests are sent every Interval no
+// matter how long replies take, a separate reader matches the replies.
+// fn is never called concurrently. Run returns the error that stopped it,
+// or nil when ctx was cancelled or all probes are done.
+func (p *Pinger) Run(ctx context.Context, fn func(Result)) error {
+    if p.opts.FlowLabel < 0 || p.opts.FlowLabel > MaxFlowLabel {
+        return fmt.Errorf("flow label %d does not fit in 20 bits", p.opts.FlowLabel)
+    }
+    if p.opts.FlowLabel != 0 && !p.opts.IPv6 {
+        return fmt.Errorf("flow labels only exist in IPv6")
+    }
+    if p.opts.PayloadCheck == CheckHash && p.opts.PayloadSize < HashSize {
+        return fmt.Errorf("payload of %d bytes cannot hold the %d byte hash", p.opts.PayloadSize, HashSize)
+    }
+    if p.opts.Timestamp && p.opts.IPv6 {
+        return fmt.Errorf("ICMP timestamp requests only exist in IPv4")
+    }
+
+    sock, err := p.open()
+    if err != nil {
+        return err
+    }
+    p.sockMutex.Lock()
+    p.sock = sock
+    p.closed = false
+    p.sockMutex.Unlock()
+    defer p.close()
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    go func() {
+        <-ctx.Done()
+        p.socket().conn.SetReadDeadline(time.Now())
+    }()
+
+    results := make(chan Result, 64)
+    emit := func(r Result) {
+        select {
+        case results <- r:
+        case <-ctx.Done():
+        }
+    }
+
+    type sendDone struct {
+        sent int
+        err  error
+    }
+    sending := make(chan sendDone, 1)
+    go func() {
+        sent, err := p.sendLoop(ctx, emit)
+        sending <- sendDone{sent, err}
+    }()
+    go p.receive(ctx, emit)
+    go p.expire(ctx, emit)
+
+    // Once the sender is done, Run ends when every probe has its result.
+    // With Broadcast it lingers for another Timeout to collect the replies
+    // of slower hosts.
+    sent := -1
+    delivered := 0
+    var linger <-chan time.Time
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case <-linger:
+            return nil
+        case done := <-sending:
+            if done.err != nil {
+                return done.err
+            }
+            sent = done.sent
+        case r := <-results:
+            fn(r)
+            if !r.Duplicate {
+                delivered++
+            }
+        }
+        if sent >= 0 && delivered >= sent && linger == nil {
+            if !p.opts.Broadcast {
+                return nil
+            }
+            linger = time.After(p.opts.Timeout)
+        }
+    }
+}
+
+// sendLoop sends a request every Interval until ctx is done or Count
+// requests are sent, and returns how many were sent. Only errors that make
+// further probing pointless are returned.
+func (p *Pinger) sendLoop(ctx context.Context, emit func(Result)) (int, error) {
+    for seq := 1; ; seq++ {
+        if err := p.sendProbe(ctx, seq, emit); err != nil {
+            return seq - 1, err
+        }
+        if p.opts.Count > 0 && seq >= p.opts.Count {
+            return seq, nil
+        }
+        select {
+        case <-ctx.Done():
+            return seq, nil
+        case <-time.After(p.gap(seq)):
+        }
+    }
+}
+
+// gap returns the time between request seq and the next one.
+func (p *Pinger) gap(seq int) time.Duration {
+    if len(p.opts.Schedule) == 0 {
+        return p.opts.Interval
+    }
+    return p.opts.Schedule[(seq-1)%len(p.opts.Schedule)]
+}
+
+// sendProbe sends the echo request with the given probe number and
+// registers it as outstanding.
+func (p *Pinger) sendProbe(ctx context.Context, seq int, emit func(Result)) error {
+    // The echo sequence field is 16 bits wide: after 65535 probes it wraps,
+    // so requests are sent and replies matched by the masked number.
+    wireSeq := seq & SeqMask
+    data, hash := p.probeData(wireSeq)
+    var msg *icmp.Message
+    if p.opts.Timestamp {
+        msg = &icmp.Message{
+            Type: ipv4.ICMPTypeTimestamp,
+            Code: 0,
+            Body: &icmp.RawBody{Data: timestampBody(p.opts.ID, wireSeq, time.Now())},
+        }
+    } else if p.opts.Raw {
+        var typ icmp.Type = ipv4.ICMPType(p.rawType())
+        if p.opts.IPv6 {
+            typ = ipv6.ICMPType(p.rawType())
+        }
+        msg = &icmp.Message{
+            Type: typ,
+            Code: p.opts.RawCode,
+            Body: &icmp.Echo{
+                ID:   p.opts.ID,
+                Seq:  wireSeq,
+                Data: data,
+            },
+        }
+    } else if p.opts.IPv6 {
+        msg = &icmp.Message{
+            Type: ipv6.ICMPTypeEchoRequest,
+            Code: 0,
+            Body: &icmp.Echo{
+                ID:   p.opts.ID,
+                Seq:  wireSeq,
+                Data: data,
+            },
+        }
+    } else {
+        msg = &icmp.Message{
+            Type: ipv4.ICMPTypeEcho,
+            Code: 0,
+            Body: &icmp.Echo{
+                ID:   p.opts.ID,
+                Seq:  wireSeq,
+                Data: data,
+            },
+        }
+    }
+
+    msgBytes, err := msg.Marshal(nil)
+    if err != nil {
+        return fmt.Errorf("marshalling ICMP message: %w", err)
+    }
+
+    // Register the probe before sending so that even the fastest reply
+    // finds it. A probe still waiting under the same wire number is 65536
+    // probes old; it can only be resolved as timed out.
+    start := time.Now()
+    p.mutex.Lock()
+    if !p.lastSend.IsZero() {
+        deviation := start.Sub(p.lastSend) - p.gap(seq-1)
+        if deviation < 0 {
+            deviation = -deviation
+        }
+        p.gaps++
+        p.pacingSum += deviation
+        if deviation > p.pacingMax {
+            p.pacingMax = deviation
+        }
+    }
+    p.lastSend = start
+    stale, wrapped := p.outstanding[wireSeq]
+    p.outstanding[wireSeq] = probe{seq: seq, sent: start, hash: hash}
+    p.mutex.Unlock()
+    if wrapped && !stale.replied {
+        emit(Result{Seq: stale.seq, Sent: stale.sent, RTT: start.Sub(stale.sent), Status: StatusTimeout})
+    }
+
+    sock := p.socket()
+    n, err := sock.send(msgBytes)
+    if err != nil {
+        p.take(wireSeq)
+        emit(Result{Seq: seq, Sent: start, Status: StatusSendError, Err: err})
+        p.sendErrors++
+        if fatalSocketError(err) || p.sendErrors >= reconnectErrors {
+            p.reconnect(ctx, sock, err)
+            p.sendErrors = 0
+        }
+        return nil
+    }
+    p.sendErrors = 0
+    p.sentBytes.Add(int64(n))
+    if n != len(msgBytes) {
+        p.logf("Sent %d bytes, expected to send %d bytes\n", n, len(msgBytes))
+    }
+    return nil
+}
+
+// take removes the outstanding probe with the given wire sequence number.
+// ok is false if there is none, e.g. for a duplicate or a reply that comes
+// after the probe timed out.
+func (p *Pinger) take(wireSeq int) (probe, bool) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    pr, ok := p.outstanding[wireSeq]
+    if ok {
+        delete(p.outstanding, wireSeq)
+    }
+    return pr, ok
+}
+
+// takeReply resolves the outstanding probe answered by an echo reply. With
+// Broadcast the probe stays registered to match replies from further hosts,
+// which are reported as duplicates.
+func (p *Pinger) takeReply(wireSeq int) (pr probe, duplicate bool, ok bool) {
+    if !p.opts.Broadcast {
+        pr, ok = p.take(wireSeq)
+        return pr, false, ok
+    }
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    pr, ok = p.outstanding[wireSeq]
+    if !ok {
+        return pr, false, false
+    }
+    duplicate = pr.replied
+    pr.replied = true
+    p.outstanding[wireSeq] = pr
+    return pr, duplicate, true
+}
+
+// takeOldest removes the outstanding probe that was sent first and still
+// waits for its result. It is blamed for replies that cannot be matched to
+// a probe by their content.
+func (p *Pinger) takeOldest() (probe, bool) {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    oldestKey := -1
+    for key, pr := range p.outstanding {
+        if pr.replied {
+            continue
+        }
+        if oldestKey < 0 || pr.seq < p.outstanding[oldestKey].seq {
+            oldestKey = key
+        }
+    }
+    if oldestKey < 0 {
+        return probe{}, false
+    }
+    pr := p.outstanding[oldestKey]
+    delete(p.outstanding, oldestKey)
+    return pr, true
+}
+
+// receive reads ICMP messages until ctx is done and resolves the outstanding
+// probes they answer. The raw socket sees every ICMP message arriving at the
+// host, so messages for other processes are skipped.
+func (p *Pinger) receive(ctx context.Context, emit func(Result)) {
+    var protocol int
+    if p.opts.IPv6 {
+        protocol = ipv6.ICMPTypeEchoReply.Protocol()
+    } else {
+        protocol = ipv4.ICMPTypeEchoReply.Protocol()
+    }
+
+    reply := make([]byte, p.opts.BufSize)
+    readErrors := 0
+    var drained *socket
+    draining := false
+    discarded := 0
+    for {
+        sock := p.socket()
+        if p.opts.Drain && sock != drained {
+            // Read without blocking until the queue is empty.
+            drained = sock
+            draining = true
+            discarded = 0
+            sock.conn.SetReadDeadline(time.Now())
+        }
+        n, ttl, peer, stamp, err := sock.read(reply)
+        received := time.Now()
+        if !stamp.IsZero() {
+            received = stamp
+        }
+        if ctx.Err() != nil {
+            return
+        }
+        if draining {
+            if err != nil {
+                draining = false
+                sock.conn.SetReadDeadline(time.Time{})
+                if ctx.Err() != nil {
+                    return
+                }
+                if discarded > 0 {
+                    p.logf("Discarded %d stale ICMP messages queued for %s\n", discarded, p.opts.Addr)
+                }
+                continue
+            }
+            discarded++
+        }
+        if err != nil {
+            if p.socket() != sock {
+                // Closed by a reconnection, continue with the new socket.
+                continue
+            }
+            if readErrors++; fatalSocketError(err) || readErrors >= reconnectErrors {
+                p.reconnect(ctx, sock, err)
+                readErrors = 0
+            }
+            if pr, ok := p.takeOldest(); ok {
+                emit(Result{Seq: pr.seq, Sent: pr.sent, RTT: received.Sub(pr.sent), Status: StatusRecvError, Err: err})
+            } else {
+                p.logf("Error receiving ICMP reply: %v\n", err)
+            }
+            // Do not spin on a socket that keeps failing.
+            time.Sleep(10 * time.Millisecond)
+            continue
+        }
+
+        readErrors = 0
+
+        msg, parseErr := icmp.ParseMessage(protocol, reply[:n])
+        if parseErr != nil {
+            if draining {
+                continue
+            }
+            if pr, ok := p.takeOldest(); ok {
+                emit(Result{Seq: pr.seq, Sent: pr.sent, RTT: received.Sub(pr.sent), Status: StatusParseError,
+                    Peer: peer, Err: parseErr, Raw: append([]byte(nil), reply[:n]...)})
+            }
+            continue
+        }
+
+        var pr probe
+        var ok bool
+        result := Result{Peer: peer, Message: msg, TTL: ttl, KernelTimestamp: !stamp.IsZero()}
+        switch msg.Type {
+        case ipv4.ICMPTypeEcho, ipv6.ICMPTypeEchoRequest, ipv4.ICMPTypeTimestamp:
+            // IPv6 raw sockets on the pinging host see their own requests,
+            // and a loopback target shows the timestamp requests.
+            continue
+        case ipv4.ICMPTypeTimestampReply:
+            body, isRaw := msg.Body.(*icmp.RawBody)
+            if !isRaw || !p.opts.Timestamp {
+                continue
+            }
+            ts, parsed := parseTimestampReply(body.Data)
+            if !parsed || ts.id != p.opts.ID {
+                continue
+            }
+            if pr, _, ok = p.takeReply(ts.seq); !ok {
+                continue
+            }
+            result.Status = StatusReply
+            if ts.receive&nonStandardTime != 0 || ts.transmit&nonStandardTime != 0 {
+                result.NonStandardTime = true
+            } else {
+                result.Forward = oneWay(ts.originate, ts.receive)
+                result.Return = oneWay(ts.transmit, msOfDay(received))
+            }
+        case ipv4.ICMPTypeEchoReply, ipv6.ICMPTypeEchoReply:
+            echo, isEcho := msg.Body.(*icmp.Echo)
+            if !isEcho || echo.ID != p.opts.ID {
+                continue
+            }
+            var duplicate bool
+            if pr, duplicate, ok = p.takeReply(echo.Seq); !ok {
+                continue
+            }
+            result.Status = StatusReply
+            result.Duplicate = duplicate
+            if !duplicate {
+                result.Reordered = pr.seq < p.lastReplied
+                p.lastReplied = max(p.lastReplied, pr.seq)
+            }
+            result.PayloadLen = len(echo.Data)
+            result.Truncated = len(echo.Data) < len(p.payload)
+            result.Corrupted = p.corrupted(echo.Data, echo.Seq, pr)
+        case ipv4.ICMPTypeDestinationUnreachable, ipv6.ICMPTypeDestinationUnreachable:
+            body, isUnreach := msg.Body.(*icmp.DstUnreach)
+            if !isUnreach {
+                continue
+            }
+            quotedID, quotedSeq, quoted := quotedEcho(body.Data, p.opts.IPv6)
+            if !quoted || quotedID != p.opts.ID {
+                continue
+            }
+            if pr, ok = p.take(quotedSeq); !ok || pr.replied {
+                continue
+            }
+            result.Status = StatusUnreachable
+            result.Reason = unreachableReason(msg.Type, msg.Code)
+        default:
+            if draining || p.ownRaw(msg) {
+                continue
+            }
+            if pr, ok = p.takeOldest(); !ok {
+                continue
+            }
+            result.Status = StatusUnexpected
+            result.Raw = append([]byte(nil), reply[:n]...)
+        }
+        if draining {
+            discarded--
+        }
+        p.receivedBytes.Add(int64(n))
+        result.Seq = pr.seq
+        result.Sent = pr.sent
+        result.RTT = received.Sub(pr.sent)
+        emit(result)
+    }
+}
+
+// rawType is the ICMP type of the Raw messages.
+func (p *Pinger) rawType() int {
+    switch {
+    case p.opts.RawType >= 0:
+        return p.opts.RawType
+    case p.opts.IPv6:
+        return int(ipv6.ICMPTypeEchoRequest)
+    }
+    return int(ipv4.ICMPTypeEcho)
+}
+
+// ownRaw reports whether msg is one of the Raw messages sent by p, which
+// an IPv6 raw socket sees like its own echo requests.
+func (p *Pinger) ownRaw(msg *icmp.Message) bool {
+    if !p.opts.Raw || msg.Code != p.opts.RawCode {
+        return false
+    }
+    var typ int
+    switch t := msg.Type.(type) {
+    case ipv4.ICMPType:
+        typ = int(t)
+    case ipv6.ICMPType:
+        typ = int(t)
+    }
+    if typ != p.rawType() {
+        return false
+    }
+    switch body := msg.Body.(type) {
+    case *icmp.Echo:
+        return body.ID == p.opts.ID
+    case *icmp.RawBody:
+        return len(body.Data) >= 2 && int(body.Data[0])<<8|int(body.Data[1]) == p.opts.ID
+    }
+    return false
+}
+
+// reader returns the function receive reads replies with. The receive time
+// is zero unless it comes from the kernel.
+func (p *Pinger) reader(conn *net.IPConn) func(b []byte) (int, int, net.Addr, time.Time, error) {
+    if p.opts.KernelTimestamps {
+        read, err := timestampReader(conn, p.opts.IPv6)
+        if err == nil {
+            return read
+        }
+        p.logf("Kernel receive timestamps unavailable, timing replies in user space: %v\n", err)
+    }
+    read := replyReader(conn, p.opts.IPv6)
+    return func(b []byte) (int, int, net.Addr, time.Time, error) {
+        n, ttl, peer, err := read(b)
+        return n, ttl, peer, time.Time{}, err
+    }
+}
+
+// replyReader returns a function reading one message from conn together
+// with the TTL or hop limit of the packet that carried it. Where the
+// platform cannot deliver that as a control message the TTL is 0.
+func replyReader(conn *net.IPConn, isIPv6 bool) func(b []byte) (n int, ttl int, peer net.Addr, err error) {
+    if isIPv6 {
+        pc := ipv6.NewPacketConn(conn)
+        if pc.SetControlMessage(ipv6.FlagHopLimit, true) == nil {
+            return func(b []byte) (int, int, net.Addr, error) {
+                n, cm, peer, err := pc.ReadFrom(b)
+                if cm == nil {
+                    return n, 0, peer, err
+                }
+                return n, cm.HopLimit, peer, err
+            }
+        }
+    } else {
+        pc := ipv4.NewPacketConn(conn)
+        if pc.SetControlMessage(ipv4.FlagTTL, true) == nil {
+            return func(b []byte) (int, int, net.Addr, error) {
+                n, cm, peer, err := pc.ReadFrom(b)
+                if cm == nil {
+                    return n, 0, peer, err
+                }
+                return n, cm.TTL, peer, err
+            }
+        }
+    }
+    return func(b []byte) (int, int, net.Addr, error) {
+        n, peer, err := conn.ReadFrom(b)
+        return n, 0, peer, err
+    }
+}
+
+// expire resolves probes that have waited longer than Timeout as timed out.
+func (p *Pinger) expire(ctx context.Context, emit func(Result)) {
+    tick := p.opts.Timeout / 10
+    if tick < time.Millisecond {
+        tick = time.Millisecond
+    } else if tick > 50*time.Millisecond {
+        tick = 50 * time.Millisecond
+    }
+    ticker := time.NewTicker(tick)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case now := <-ticker.C:
+            var expired []probe
+            p.mutex.Lock()
+            for key, pr := range p.outstanding {
+                if now.Sub(pr.sent) >= p.opts.Timeout {
+                    if !pr.replied {
+                        expired = append(expired, pr)
+                    }
+                    delete(p.outstanding, key)
+                }
+            }
+            p.mutex.Unlock()
+            sort.Slice(expired, func(i, j int) bool { return expired[i].seq < expired[j].seq })
+            for _, pr := range expired {
+                emit(Result{Seq: pr.seq, Sent: pr.sent, RTT: now.Sub(pr.sent), Status: StatusTimeout})
+            }
+        }
+    }
+}
+
+// quotedEcho extracts the identifier and sequence number of the echo request
+// quoted in the body of an ICMP error: the original IP header followed by at
+// least the first 8 bytes of the original ICMP message.
+func quotedEcho(data []byte, isIPv6 bool) (id int, seq int, ok bool) {
+    var headerLen int
+    var echoType byte
+    if isIPv6 {
+        headerLen = ipv6.HeaderLen
+        echoType = byte(ipv6.ICMPTypeEchoRequest)
+    } else {
+        if len(data) < ipv4.HeaderLen {
+            return 0, 0, false
+        }
+        headerLen = int(data[0]&0x0f) * 4
+        echoType = byte(ipv4.ICMPTypeEcho)
+    }
+    if len(data) < headerLen+ICMPHeaderSize {
+        return 0, 0, false
+    }
+    inner := data[headerLen:]
+    if inner[0] != echoType {
+        return 0, 0, false
+    }
+    return int(inner[4])<<8 | int(inner[5]), int(inner[6])<<8 | int(inner[7]), true
+}
+
+// unreachableReason names the destination unreachable code.
+func unreachableReason(typ icmp.Type, code int) string {
+    if typ == ipv6.ICMPTypeDestinationUnreachable {
+        switch code {
+        case 0:
+            return "no route"
+        case 1:
+            return "admin prohibited"
+        case 2:
+            return "beyond scope of source"
+        case 3:
+            return "address unreachable"
+        case 4:
+            return "port unreachable"
+        case 5:
+            return "source address failed policy"
+        case 6:
+            return "reject route"
+        }
+        return fmt.Sprintf("unreachable code %d", code)
+    }
+    switch code {
+    case 0, 6, 11:
+        return "net unreachable"
+    case 1, 7, 12:
+        return "host unreachable"
+    case 2:
+        return "protocol unreachable"
+    case 3:
+        return "port unreachable"
+    case 4:
+        return "fragmentation needed"
+    case 5:
+        return "source route failed"
+    case 9, 10, 13:
+        return "admin prohibited"
+    case 14:
+        return "host precedence violation"
+    case 15:
+        return "precedence cutoff"
+    }
+    return fmt.Sprintf("unreachable code %d", code)
+}
@@ -0,0 +1,102 @@
+package pinger
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+
+    "golang.org/x/net/icmp"
+    "golang.org/x/net/ipv4"
+)
+
+// fakeMessage is an ICMP message the fake socket delivers, with the kernel
+// receive time that receive measures the RTT against.
+type fakeMessage struct {
+    data     []byte
+    received time.Time
+}
+
+// fakeSocket returns a socket reading the given messages in order, then
+// blocking until ctx is done like a socket with nothing more to read.
+func fakeSocket(ctx context.Context, messages []fakeMessage) *socket {
+    queue := make(chan fakeMessage, len(messages))
+    for _, m := range messages {
+        queue <- m
+    }
+    peer := &net.IPAddr{IP: net.ParseIP("192.0.2.1")}
+    return &socket{
+        read: func(b []byte) (int, int, net.Addr, time.Time, error) {
+            select {
+            case m := <-queue:
+                return copy(b, m.data), 64, peer, m.received, nil
+            case <-ctx.Done():
+                return 0, 0, nil, time.Time{}, net.ErrClosed
+            }
+        },
+    }
+}
+
+func echoReply(t *testing.T, id, seq int, data []byte) []byte {
+    t.Helper()
+    msg := icmp.Message{
+        Type: ipv4.ICMPTypeEchoReply,
+        Body: &icmp.Echo{ID: id, Seq: seq, Data: data},
+    }
+    b, err := msg.Marshal(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return b
+}
+
+// TestReceiveSkipsForeignReplies feeds the receiver the replies other
+// processes and earlier probes get on the same raw socket, interleaved with
+// the one reply to the outstanding probe.
+func TestReceiveSkipsForeignReplies(t *testing.T) {
+    const id = 0x1234
+    p := New(Options{Addr: "192.0.2.1", ID: id, Timeout: 20 * time.Millisecond, PayloadSize: 56})
+    sent := time.Now()
+    p.outstanding[7] = probe{seq: 7, sent: sent}
+
+    at := func(ms int) time.Time { return sent.Add(time.Duration(ms) * time.Millisecond) }
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    p.sock = fakeSocket(ctx, []fakeMessage{
+        {echoReply(t, id+1, 7, p.payload), at(2)},   // another process, same sequence
+        {echoReply(t, id, 6, p.payload), at(3)},     // stale, its probe timed out
+        {echoReply(t, 0x4321, 1, p.payload), at(4)}, // another process
+        {echoReply(t, id, 999, p.payload), at(5)},   // never sent
+        {echoReply(t, id, 7, p.payload), at(12)},    // ours
+        {echoReply(t, id, 7, p.payload), at(13)},    // duplicate of ours
+    })
+
+    results := make(chan Result, 16)
+    emit := func(r Result) { results <- r }
+    go p.receive(ctx, emit)
+
+    select {
+    case r := <-results:
+        if r.Status != StatusReply || r.Seq != 7 {
+            t.Fatalf("got %v for probe %d, want a reply for probe 7", r.Status, r.Seq)
+        }
+        if r.RTT != 12*time.Millisecond {
+            t.Errorf("RTT is %v, want 12ms", r.RTT)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("no result for the reply to probe 7")
+    }
+
+    // Past the timeout the probe must not time out as well.
+    go p.expire(ctx, emit)
+    time.Sleep(5 * p.opts.Timeout)
+    cancel()
+    select {
+    case r := <-results:
+        t.Errorf("unexpected %v for probe %d", r.Status, r.Seq)
+    default:
+    }
+    if n := p.Outstanding(); n != 0 {
+        t.Errorf("%d probes still outstanding, want 0", n)
+    }
+}
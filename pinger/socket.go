@@ -0,0 +1,142 @@
+package pinger
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "syscall"
+    "time"
+)
+
+const (
+    // reconnectErrors is the number of consecutive send or receive errors
+    // after which the socket is considered broken even if the errors do not
+    // say so.
+    reconnectErrors = 10
+    // reconnectBackoff is the wait before the second attempt to re-create
+    // the socket, doubled for every further one up to reconnectMaxBackoff.
+    reconnectBackoff    = 100 * time.Millisecond
+    reconnectMaxBackoff = 30 * time.Second
+)
+
+// socket is an open ICMP socket together with the functions sending
+// requests to the destination and reading replies from it.
+type socket struct {
+    conn *net.IPConn
+    send func(b []byte) (int, error)
+    read func(b []byte) (n int, ttl int, peer net.Addr, received time.Time, err error)
+}
+
+// open creates the ICMP socket and applies the options to it.
+func (p *Pinger) open() (*socket, error) {
+    network := "ip4:icmp"
+    if p.opts.IPv6 {
+        network = "ip6:ipv6-icmp"
+    }
+    packetConn, err := net.ListenPacket(network, p.opts.Source)
+    if err != nil {
+        return nil, fmt.Errorf("listening to ICMP: %w", err)
+    }
+    conn := packetConn.(*net.IPConn)
+
+    destAddr := &net.IPAddr{IP: net.ParseIP(p.opts.Addr)}
+    sock := &socket{conn: conn}
+    sock.send = func(b []byte) (int, error) {
+        return conn.WriteTo(b, destAddr)
+    }
+    if p.opts.Broadcast {
+        if err := enableBroadcast(conn); err != nil {
+            conn.Close()
+            return nil, fmt.Errorf("enabling broadcast: %w", err)
+        }
+    }
+    if p.opts.DontFragment {
+        if err := setDontFragment(conn, p.opts.IPv6); err != nil {
+            conn.Close()
+            return nil, fmt.Errorf("setting don't fragment: %w", err)
+        }
+    }
+    if p.opts.FlowLabel != 0 {
+        sock.send, err = flowLabelSender(conn, destAddr.IP, uint32(p.opts.FlowLabel))
+        if err != nil {
+            conn.Close()
+            return nil, fmt.Errorf("setting flow label: %w", err)
+        }
+    }
+    sock.read = p.reader(conn)
+    return sock, nil
+}
+
+// socket returns the socket currently in use.
+func (p *Pinger) socket() *socket {
+    p.sockMutex.Lock()
+    defer p.sockMutex.Unlock()
+    return p.sock
+}
+
+// close closes the socket at the end of Run.
+func (p *Pinger) close() {
+    p.sockMutex.Lock()
+    defer p.sockMutex.Unlock()
+    p.closed = true
+    p.sock.conn.Close()
+}
+
+// fatalSocketError reports whether err means that the socket itself is
+// broken, rather than the network behind it.
+func fatalSocketError(err error) bool {
+    return errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.EBADF) || errors.Is(err, syscall.ENOTSOCK)
+}
+
+// reconnect replaces sock, which failed with err, by a new socket. The new
+// socket is opened in the background, retrying with backoff until it works
+// or ctx is done, while probes keep failing on the old one. Nothing is done
+// if sock was replaced already or a reconnection is under way.
+func (p *Pinger) reconnect(ctx context.Context, sock *socket, err error) {
+    p.sockMutex.Lock()
+    if p.sock != sock || p.reconnecting || p.closed || ctx.Err() != nil {
+        p.sockMutex.Unlock()
+        return
+    }
+    p.reconnecting = true
+    p.sockMutex.Unlock()
+    p.logf("ICMP socket to %s failed: %v, re-creating it\n", p.opts.Addr, err)
+
+    go func() {
+        backoff := reconnectBackoff
+        for attempt := 1; ; attempt++ {
+            fresh, err := p.open()
+            if err == nil {
+                p.sockMutex.Lock()
+                p.reconnecting = false
+                if p.closed {
+                    p.sockMutex.Unlock()
+                    fresh.conn.Close()
+                    return
+                }
+                p.sock = fresh
+                p.sockMutex.Unlock()
+                // Closing the old socket wakes up the reader blocked on it.
+                sock.conn.Close()
+                if ctx.Err() != nil {
+                    fresh.conn.SetReadDeadline(time.Now())
+                }
+                p.logf("ICMP socket to %s re-created (attempt %d)\n", p.opts.Addr, attempt)
+                return
+            }
+            select {
+            case <-ctx.Done():
+                p.sockMutex.Lock()
+                p.reconnecting = false
+                p.sockMutex.Unlock()
+                return
+            case <-time.After(backoff):
+            }
+            backoff *= 2
+            if backoff > reconnectMaxBackoff {
+                backoff = reconnectMaxBackoff
+            }
+        }
+    }()
+}
@@ -0,0 +1,79 @@
+package pinger
+
+import (
+    "net"
+    "time"
+    "unsafe"
+
+    "golang.org/x/net/ipv4"
+    "golang.org/x/net/ipv6"
+    "golang.org/x/sys/unix"
+)
+
+// timestampReader enables SO_TIMESTAMPNS on conn and returns a read function
+// that reports when the kernel received each packet, which leaves the
+// scheduling delay of the reading goroutine out of the RTT. The TTL or hop
+// limit is read from the same control messages as replyReader does. A
+// packet without a timestamp reports the zero time.
+func timestampReader(conn *net.IPConn, isIPv6 bool) (func(b []byte) (n int, ttl int, peer net.Addr, received time.Time, err error), error) {
+    rawConn, err := conn.SyscallConn()
+    if err != nil {
+        return nil, err
+    }
+    var sockErr error
+    err = rawConn.Control(func(fd uintptr) {
+        if sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); sockErr != nil {
+            return
+        }
+        // The TTL is best effort, as in replyReader.
+        if isIPv6 {
+            unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVHOPLIMIT, 1)
+        } else {
+            unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTTL, 1)
+        }
+    })
+    if err != nil {
+        return nil, err
+    }
+    if sockErr != nil {
+        return nil, sockErr
+    }
+
+    oob := make([]byte, 256)
+    return func(b []byte) (int, int, net.Addr, time.Time, error) {
+        n, oobn, _, peer, err := conn.ReadMsgIP(b, oob)
+        if err != nil {
+            return n, 0, peer, time.Time{}, err
+        }
+        // Unlike ReadFrom, ReadMsgIP leaves the IPv4 header in place.
+        if !isIPv6 && n >= ipv4.HeaderLen && b[0]>>4 == 4 {
+            headerLen := int(b[0]&0x0f) * 4
+            if headerLen <= n {
+                n = copy(b, b[headerLen:n])
+            }
+        }
+
+        var received time.Time
+        var ttl int
+        if messages, err := unix.ParseSocketControlMessage(oob[:oobn]); err == nil {
+            for _, m := range messages {
+                if m.Header.Level == unix.SOL_SOCKET && m.Header.Type == unix.SCM_TIMESTAMPNS && len(m.Data) >= int(unsafe.Sizeof(unix.Timespec{})) {
+                    ts := (*unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+                    received = time.Unix(int64(ts.Sec), int64(ts.Nsec))
+                }
+            }
+        }
+        if isIPv6 {
+            var cm ipv6.ControlMessage
+            if cm.Parse(oob[:oobn]) == nil {
+                ttl = cm.HopLimit
+            }
+        } else {
+            var cm ipv4.ControlMessage
+            if cm.Parse(oob[:oobn]) == nil {
+                ttl = cm.TTL
+            }
+        }
+        return n, ttl, peer, received, nil
+    }, nil
+}
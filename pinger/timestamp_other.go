@@ -0,0 +1,14 @@
+//go:build !linux
+
+package pinger
+
+import (
+    "errors"
+    "net"
+    "time"
+)
+
+// timestampReader is only implemented on Linux.
+func timestampReader(conn *net.IPConn, isIPv6 bool) (func(b []byte) (n int, ttl int, peer net.Addr, received time.Time, err error), error) {
+    return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "math"
+
+    termui "github.com/gizak/termui/v3"
+    "github.com/gizak/termui/v3/widgets"
+)
+
+// plotYLabelsWidth is the width termui reserves for the Y axis labels left
+// of the axis line.
+const plotYLabelsWidth = 4
+
+// gapDimColor is the muted color of -gap-style dim, dark grey in the 256
+// color palette termui uses.
+const gapDimColor termui.Color = 8
+
+// gapPlot is a braille line chart like widgets.Plot that leaves a gap for
+// NaN values instead of drawing a line through them, or bridges the gap
+// with a dashed line depending on GapStyle. The block, axes and labels are
+// still drawn by widgets.Plot.
+type gapPlot struct {
+    widgets.Plot
+    GapStyle string // -gap-style: break, interpolate or dim
+
+    // MinVal is the bottom of the Y axis. Below 0, for series that go
+    // negative like -diff, the axis is labelled again from MinVal up and a
+    // dim line marks 0.
+    MinVal float64
+
+    // RefLines are dashed horizontal lines across the plot, like the
+    // -warn and -crit thresholds, labelled at the right end. Lines outside
+    // the Y axis are left out.
+    RefLines []refLine
+
+    // Fill marks the series, by their index in Data, whose area down to
+    // the bottom of the plot, or to 0 below MinVal 0, is filled in their
+    // color with -fill.
+    Fill []bool
+
+    // Bands are shaded ranges behind everything else, like the -band
+    // percentiles, with a low and a high edge per column of Data.
+    Bands []plotBand
+}
+
+// plotBand is a shaded range of a gapPlot, both edges NaN where there is
+// none.
+type plotBand struct {
+    Low, High []float64
+    Color     termui.Color
+}
+
+// refLine is a horizontal reference line of a gapPlot.
+type refLine struct {
+    Value float64 // in the units of the data, after any log scaling
+    Label string
+    Color termui.Color
+}
+
+func newGapPlot() *gapPlot {
+    return &gapPlot{Plot: *widgets.NewPlot()}
+}
+
+func (p *gapPlot) Draw(buf *termui.Buffer) {
+    data := p.Data
+    maxVal := p.MaxVal
+    if maxVal == 0 {
+        maxVal = maxFloat64(nanFree(data))
+    }
+    span := maxVal - p.MinVal
+
+    // Let widgets.Plot draw everything but the lines.
+    configured := p.MaxVal
+    p.Data = nil
+    if p.MinVal < 0 {
+        p.MaxVal = span
+    }
+    p.Plot.Draw(buf)
+    p.Data = data
+    p.MaxVal = configured
+    // widgets.Plot draws the axes and labels in white whatever AxesColor
+    // says, recolor them for the -theme.
+    if p.AxesColor != termui.ColorWhite {
+        for point, cell := range buf.CellMap {
+            if point.In(p.Inner) && cell.Style.Fg == termui.ColorWhite {
+                cell.Style.Fg = p.AxesColor
+                buf.CellMap[point] = cell
+            }
+        }
+    }
+    if p.MinVal < 0 {
+        p.relabel(buf, span)
+    }
+    if span <= 0 || math.IsNaN(span) {
+        return
+    }
+
+    drawArea := image.Rect(
+        p.Inner.Min.X+plotYLabelsWidth+1, p.Inner.Min.Y,
+        p.Inner.Max.X, p.Inner.Max.Y-2,
+    )
+    point := func(j int, val float64) image.Point {
+        height := int(((val - p.MinVal) / span) * float64(drawArea.Dy()-1))
+        return image.Pt((drawArea.Min.X+j)*2, (drawArea.Max.Y-height-1)*4)
+    }
+
+    canvas := termui.NewCanvas()
+    canvas.Rectangle = drawArea
+    if p.MinVal < 0 {
+        canvas.SetLine(point(0, 0), point(drawArea.Dx()-1, 0), gapDimColor)
+    }
+    p.shade(canvas, point)
+    p.fill(canvas, data, point)
+    var labels []refLine
+    for _, ref := range p.RefLines {
+        if ref.Value < p.MinVal || ref.Value > maxVal {
+            continue
+        }
+        for j := 0; j+1 < drawArea.Dx(); j += 2 {
+            canvas.SetLine(point(j, ref.Value), point(j+1, ref.Value), ref.Color)
+        }
+        labels = append(labels, ref)
+    }
+    for i, line := range data {
+        color := termui.SelectColor(p.LineColors, i)
+        gapColor := color
+        if p.GapStyle == "dim" {
+            gapColor = gapDimColor
+        }
+        last := -1 // the latest value that is not NaN
+        for j, val := range line {
+            if math.IsNaN(val) {
+                continue
+            }
+            switch {
+            case j > 0 && last == j-1:
+                canvas.SetLine(point(j-1, line[j-1]), point(j, val), color)
+            case last >= 0 && p.GapStyle != "break":
+                // Dash the line between the values around the gap, one
+                // column drawn, one left out.
+                for k := last; k < j; k += 2 {
+                    from := line[last] + (val-line[last])*float64(k-last)/float64(j-last)
+                    to := line[last] + (val-line[last])*float64(k+1-last)/float64(j-last)
+                    canvas.SetLine(point(k, from), point(k+1, to), gapColor)
+                }
+                canvas.SetPoint(point(j, val), color)
+            default:
+                canvas.SetPoint(point(j, val), color)
+            }
+            last = j
+        }
+    }
+    canvas.Draw(buf)
+    for _, ref := range labels {
+        row := point(0, ref.Value).Y / 4
+        buf.SetString(ref.Label, termui.NewStyle(ref.Color), image.Pt(drawArea.Max.X-len(ref.Label), row))
+    }
+}
+
+// shade draws the Bands first, so the fills and lines are drawn over them.
+func (p *gapPlot) shade(canvas *termui.Canvas, point func(int, float64) image.Point) {
+    for _, band := range p.Bands {
+        for j := range band.Low {
+            if math.IsNaN(band.Low[j]) || math.IsNaN(band.High[j]) {
+                continue
+            }
+            top, bottom := point(j, band.High[j]), point(j, band.Low[j])
+            for y := top.Y; y <= bottom.Y; y++ {
+                canvas.SetPoint(image.Pt(top.X, y), band.Color)
+                canvas.SetPoint(image.Pt(top.X+1, y), band.Color)
+            }
+        }
+    }
+}
+
+// fill draws the areas of the Fill series before anything else, so the
+// reference lines and all lines stay visible on top. Both dot columns of
+// a braille cell are set, for solid columns.
+func (p *gapPlot) fill(canvas *termui.Canvas, data [][]float64, point func(int, float64) image.Point) {
+    base, bottom := p.MinVal, 3 // down to the lowest dot row of the plot
+    if p.MinVal < 0 {
+        base, bottom = 0, 0
+    }
+    for i, line := range data {
+        if i >= len(p.Fill) || !p.Fill[i] {
+            continue
+        }
+        color := termui.SelectColor(p.LineColors, i)
+        for j, val := range line {
+            if math.IsNaN(val) {
+                continue
+            }
+            // SetLine draws nothing for a vertical line, set the dots.
+            top, floor := point(j, val), point(j, base).Y+bottom
+            for y := min(top.Y, floor); y <= max(top.Y, floor); y++ {
+                canvas.SetPoint(image.Pt(top.X, y), color)
+                canvas.SetPoint(image.Pt(top.X+1, y), color)
+            }
+        }
+    }
+}
+
+// relabel writes the Y axis labels of widgets.Plot again, counting from
+// MinVal instead of 0, in the same places.
+func (p *gapPlot) relabel(buf *termui.Buffer, span float64) {
+    scale := span / float64(p.Inner.Dy()-2)
+    style := termui.NewStyle(p.AxesColor)
+    for i := 0; i*2 < p.Inner.Dy()-1; i++ {
+        y := p.Inner.Max.Y - i*2 - 2
+        old := fmt.Sprintf("%.2f", float64(i)*scale*2)
+        for x := 0; x < len(old); x++ {
+            buf.SetCell(termui.NewCell(' '), image.Pt(p.Inner.Min.X+x, y))
+        }
+        // The old label may have covered the axis line.
+        axis := termui.VERTICAL_DASH
+        if i == 0 {
+            axis = termui.BOTTOM_LEFT
+        }
+        buf.SetCell(termui.NewCell(axis, style), image.Pt(p.Inner.Min.X+plotYLabelsWidth, y))
+        buf.SetString(fmt.Sprintf("%.2f", p.MinVal+float64(i)*scale*2), style, image.Pt(p.Inner.Min.X, y))
+    }
+}
+
+// nanFree returns all values of series that are not NaN as one slice, with
+// a single 0 if there are none.
+func nanFree(series [][]float64) []float64 {
+    values := []float64{0}
+    for _, line := range series {
+        for _, v := range line {
+            if !math.IsNaN(v) {
+                values = append(values, v)
+            }
+        }
+    }
+    return values
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "os"
+    "strconv"
+
+    "golang.org/x/sys/unix"
+)
+
+const (
+    // priorityNice is the nice value of -priority high.
+    priorityNice = -10
+    // priorityRealtime is the SCHED_FIFO priority of -priority realtime,
+    // the lowest, which is enough to run ahead of every normal process.
+    priorityRealtime = 1
+)
+
+// prioritySupported tells whether raisePriority does anything here.
+const prioritySupported = true
+
+// raisePriority gives the process the -priority level: "high" lowers its
+// nice value, "realtime" moves it to the SCHED_FIFO scheduler. Linux
+// schedules threads, so every thread of the process is changed; threads
+// started later inherit it.
+func raisePriority(level string) error {
+    tasks, err := os.ReadDir("/proc/self/task")
+    if err != nil {
+        return err
+    }
+    for _, task := range tasks {
+        tid, err := strconv.Atoi(task.Name())
+        if err != nil {
+            continue
+        }
+        if level == "realtime" {
+            attr := unix.SchedAttr{Size: unix.SizeofSchedAttr, Policy: unix.SCHED_FIFO, Priority: priorityRealtime}
+            err = unix.SchedSetAttr(tid, &attr, 0)
+        } else {
+            err = unix.Setpriority(unix.PRIO_PROCESS, tid, priorityNice)
+        }
+        // A thread that just exited is no reason to fail.
+        if err != nil && err != unix.ESRCH {
+            return err
+        }
+    }
+    return nil
+}
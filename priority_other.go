@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// prioritySupported tells whether raisePriority does anything here.
+const prioritySupported = false
+
+// raisePriority is not implemented on this platform, -priority is ignored
+// with a warning.
+func raisePriority(level string) error {
+    return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/signal"
+    "strconv"
+    "sync"
+    "syscall"
+)
+
+// rawWriter prints every sample as a bare line for -raw: "seq<TAB>rtt", and
+// with several targets the host first. RTTs are in ms, lost probes print
+// as the -raw-lost text.
+type rawWriter struct {
+    mutex sync.Mutex
+    lost  string
+    hosts bool
+}
+
+func (w *rawWriter) observe(t *target, s sample) {
+    rtt := w.lost
+    if !s.Lost {
+        rtt = strconv.FormatFloat(s.RTT, 'f', -1, 64)
+    }
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if w.hosts {
+        fmt.Printf("%s\t%d\t%s\n", t.addr, s.Seq, rtt)
+        return
+    }
+    fmt.Printf("%d\t%s\n", s.Seq, rtt)
+}
+
+// runRaw waits until the probes end with -n, -duration or -max-bytes, or
+// until interrupted, while the rawWriter prints the samples. It returns the
+// exit code.
+func runRaw(wg *sync.WaitGroup, cancel func(), running *bool) int {
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+    select {
+    case <-done:
+    case <-sigs:
+        cancel()
+        <-done
+    }
+    if !*running {
+        return exitError
+    }
+    return exitOK
+}
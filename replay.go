@@ -0,0 +1,64 @@
+package main
+
+import (
+    "context"
+    "net"
+    "sort"
+    "time"
+)
+
+// replayTargets creates one target per host and address found in records,
+// in order of first appearance, and returns them along with the target of
+// every record.
+func replayTargets(records []exportRecord) ([]*target, []*target) {
+    var targets []*target
+    byKey := make(map[[2]string]*target)
+    owners := make([]*target, len(records))
+    for i, record := range records {
+        key := [2]string{record.Host, record.Addr}
+        t, ok := byKey[key]
+        if !ok {
+            ip := net.ParseIP(record.Addr)
+            t = newTarget(record.Host, record.Addr, ip != nil && ip.To4() == nil, len(targets))
+            byKey[key] = t
+            targets = append(targets, t)
+        }
+        owners[i] = t
+    }
+    return targets, owners
+}
+
+// replay feeds exported records back into their targets as if they were
+// live results, keeping the original spacing between samples divided by
+// speed. A speed of zero or less replays everything at once. Records are
+// replayed in time order; lost probes get the current deadTimeout value.
+func replay(ctx context.Context, records []exportRecord, owners []*target, speed float64, deadTimeout float64) {
+    order := make([]int, len(records))
+    for i := range order {
+        order[i] = i
+    }
+    sort.SliceStable(order, func(a, b int) bool {
+        return records[order[a]].Time.Before(records[order[b]].Time)
+    })
+
+    var previous time.Time
+    for _, i := range order {
+        record := records[i]
+        if speed > 0 && !previous.IsZero() {
+            wait := time.Duration(float64(record.Time.Sub(previous)) / speed)
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(wait):
+            }
+        }
+        previous = record.Time
+
+        s := sample{Seq: record.Seq, Time: record.Time, RTT: deadTimeout, Lost: true, Status: record.Status}
+        if record.RTT != nil {
+            s.RTT = *record.RTT
+            s.Lost = false
+        }
+        owners[i].record(s)
+    }
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+// selfCheckProbes is the number of probes -self-check spreads over its
+// time limit, one reply is enough to pass.
+const selfCheckProbes = 3
+
+// selfCheckResult is the outcome of the -self-check of one target.
+type selfCheckResult struct {
+    ok     bool
+    detail string
+}
+
+// selfCheck makes sure every target can be pinged before the run starts:
+// the socket opens and one of a few probes is answered within limit. It
+// prints a PASS or FAIL line per target and reports whether all passed.
+// The probes use their own identifier, so a late reply is not taken for
+// one to the first probe of the run.
+func selfCheck(targets []*target, opts pinger.Options, limit time.Duration) bool {
+    results := make([]selfCheckResult, len(targets))
+    var wg sync.WaitGroup
+    for i, t := range targets {
+        wg.Add(1)
+        go func(i int, t *target) {
+            defer wg.Done()
+            results[i] = selfCheckTarget(t, opts, limit)
+        }(i, t)
+    }
+    wg.Wait()
+
+    fmt.Printf("Self-check, %v per target:\n", limit)
+    passed := true
+    for i, t := range targets {
+        verdict := "PASS"
+        if !results[i].ok {
+            verdict = "FAIL"
+            passed = false
+        }
+        fmt.Printf("  %s: %s, %s\n", t.name(), verdict, results[i].detail)
+    }
+    return passed
+}
+
+// selfCheckTarget pings t until the first reply or until limit is over.
+func selfCheckTarget(t *target, opts pinger.Options, limit time.Duration) selfCheckResult {
+    opts.Addr = t.addr
+    opts.IPv6 = t.useIPv6
+    opts.ID = (t.id + 0x2000) & 0xffff
+    opts.Count = selfCheckProbes
+    opts.Interval = limit / selfCheckProbes
+    opts.Schedule = nil
+    opts.Raw = false
+    opts.Timeout = limit
+    opts.Logf = nil
+
+    ctx, cancel := context.WithTimeout(context.Background(), limit)
+    defer cancel()
+    var reply *pinger.Result
+    var failure string
+    err := pinger.New(opts).Run(ctx, func(r pinger.Result) {
+        switch r.Status {
+        case pinger.StatusReply:
+            if reply == nil {
+                reply = &r
+            }
+            cancel()
+        case pinger.StatusUnreachable:
+            failure = "destination unreachable: " + r.Reason
+        case pinger.StatusSendError, pinger.StatusRecvError:
+            failure = fmt.Sprintf("%s: %v", r.Status, r.Err)
+        }
+    })
+    switch {
+    case err != nil:
+        detail := fmt.Sprintf("cannot ping: %v", err)
+        if hint := listenErrorHint(err); hint != "" {
+            detail += ". " + hint
+        }
+        return selfCheckResult{detail: detail}
+    case reply != nil:
+        return selfCheckResult{ok: true, detail: fmt.Sprintf("reply from %s in %.2f ms", t.addr, float64(reply.RTT)/float64(time.Millisecond))}
+    case failure != "":
+        return selfCheckResult{detail: failure}
+    }
+    return selfCheckResult{detail: fmt.Sprintf("no reply within %v", limit)}
+}
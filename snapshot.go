@@ -0,0 +1,291 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "math"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    termui "github.com/gizak/termui/v3"
+)
+
+// Layout of a snapshot image in pixels.
+const (
+    snapshotWidth  = 1600
+    snapshotHeight = 600
+    snapshotLeft   = 70 // room for the RTT labels
+    snapshotRight  = 20
+    snapshotTop    = 40 // room for the title
+    snapshotBottom = 40 // room for the time labels
+    snapshotTicks  = 5
+)
+
+// snapshotPalette gives the target colors of the terminal an RGB value
+// that is readable on white.
+var snapshotPalette = map[termui.Color]color.RGBA{
+    termui.ColorGreen:   {0x2e, 0x9e, 0x3e, 0xff},
+    termui.ColorYellow:  {0xd4, 0xa0, 0x00, 0xff},
+    termui.ColorCyan:    {0x00, 0x9c, 0xb8, 0xff},
+    termui.ColorMagenta: {0xb0, 0x3c, 0xb8, 0xff},
+    termui.ColorBlue:    {0x2c, 0x5c, 0xd0, 0xff},
+    termui.ColorRed:     {0xd0, 0x30, 0x30, 0xff},
+    termui.ColorWhite:   {0x50, 0x50, 0x50, 0xff},
+    termui.ColorBlack:   {0x20, 0x20, 0x20, 0xff},
+    termui.ColorClear:   {0x20, 0x20, 0x20, 0xff},
+}
+
+var (
+    snapshotAxis      = color.RGBA{0x40, 0x40, 0x40, 0xff}
+    snapshotGrid      = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+    snapshotThreshold = color.RGBA{0xe0, 0x60, 0x00, 0xff}
+)
+
+// snapshotSeries is the history of one target copied for rendering.
+type snapshotSeries struct {
+    name  string
+    color color.RGBA
+    at    []float64 // seconds since the first sample of any target
+    rtt   []float64 // ms, NaN for lost probes
+}
+
+// snapshotLine is a horizontal threshold line.
+type snapshotLine struct {
+    label string
+    value float64 // ms
+}
+
+// snapshot is everything a snapshot image shows.
+type snapshot struct {
+    title      string
+    series     []snapshotSeries
+    thresholds []snapshotLine
+    maxRTT     float64 // top of the Y axis
+    span       float64 // seconds covered by the X axis
+}
+
+// takeSnapshot copies the sample history of the targets. The -alert-rtt
+// and -fail-rtt thresholds are drawn and scaled to, the -slow threshold
+// only when the replies come near it.
+func takeSnapshot(title string, cfg *config, targets []*target) snapshot {
+    snap := snapshot{title: title}
+    var first time.Time
+    for _, t := range targets {
+        t.mutex.Lock()
+        if len(t.stamps) > 0 && (first.IsZero() || t.stamps[0].Before(first)) {
+            first = t.stamps[0]
+        }
+        t.mutex.Unlock()
+    }
+    for _, t := range targets {
+        s := snapshotSeries{name: t.name(), color: snapshotPalette[t.color()]}
+        t.mutex.Lock()
+        for i, v := range t.times {
+            at := t.stamps[i].Sub(first).Seconds()
+            if v == cfg.deadTimeout {
+                v = math.NaN()
+            } else {
+                snap.maxRTT = math.Max(snap.maxRTT, v)
+            }
+            s.at = append(s.at, at)
+            s.rtt = append(s.rtt, v)
+            snap.span = math.Max(snap.span, at)
+        }
+        t.mutex.Unlock()
+        snap.series = append(snap.series, s)
+    }
+
+    if cfg.alertRTT > 0 {
+        snap.thresholds = append(snap.thresholds, snapshotLine{"-alert-rtt", cfg.alertRTT})
+    }
+    if cfg.failRTT > 0 {
+        snap.thresholds = append(snap.thresholds, snapshotLine{"-fail-rtt", cfg.failRTT})
+    }
+    for _, l := range snap.thresholds {
+        snap.maxRTT = math.Max(snap.maxRTT, l.value)
+    }
+    if slow := float64(cfg.slowRTT); slow <= snap.maxRTT*1.5 {
+        snap.thresholds = append(snap.thresholds, snapshotLine{"slow", slow})
+        snap.maxRTT = math.Max(snap.maxRTT, slow)
+    }
+    snap.maxRTT *= 1.1
+    if snap.maxRTT == 0 {
+        snap.maxRTT = 1
+    }
+    if snap.span == 0 {
+        snap.span = 1
+    }
+    return snap
+}
+
+// x and y map a sample to the pixel position in the plot area.
+func (s *snapshot) x(at float64) float64 {
+    return snapshotLeft + at/s.span*(snapshotWidth-snapshotLeft-snapshotRight)
+}
+
+func (s *snapshot) y(rtt float64) float64 {
+    return snapshotHeight - snapshotBottom - rtt/s.maxRTT*(snapshotHeight-snapshotTop-snapshotBottom)
+}
+
+// snapshotPath returns the -snapshot file, or a name with the current time
+// in the working directory.
+func snapshotPath(cfg *config) string {
+    if cfg.snapshot != "" {
+        return cfg.snapshot
+    }
+    return time.Now().Format("pinggraph-20060102-150405.svg")
+}
+
+// writeSnapshot renders the history of the targets to path, as PNG for a
+// .png file and as SVG otherwise.
+func writeSnapshot(path, title string, cfg *config, targets []*target) error {
+    snap := takeSnapshot(title, cfg, targets)
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if strings.ToLower(filepath.Ext(path)) == ".png" {
+        err = png.Encode(file, snap.png())
+    } else {
+        w := bufio.NewWriter(file)
+        snap.svg(w)
+        err = w.Flush()
+    }
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    return err
+}
+
+// svg writes the snapshot as an SVG document with axis labels and a
+// legend.
+func (s *snapshot) svg(w *bufio.Writer) {
+    fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n",
+        snapshotWidth, snapshotHeight)
+    fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+    fmt.Fprintf(w, `<text x="%d" y="24" font-size="16">%s</text>`+"\n", snapshotLeft, xmlEscape(s.title))
+
+    left, right := float64(snapshotLeft), float64(snapshotWidth-snapshotRight)
+    top, bottom := float64(snapshotTop), float64(snapshotHeight-snapshotBottom)
+    for i := 0; i <= snapshotTicks; i++ {
+        rtt := s.maxRTT * float64(i) / snapshotTicks
+        at := s.span * float64(i) / snapshotTicks
+        fmt.Fprintf(w, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n", left, s.y(rtt), right, s.y(rtt), hexColor(snapshotGrid))
+        fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="end">%.1f ms</text>`+"\n", left-6, s.y(rtt)+4, rtt)
+        fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", s.x(at), bottom+18,
+            (time.Duration(at*float64(time.Second))).Round(time.Second/10))
+    }
+    fmt.Fprintf(w, `<polyline points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="none" stroke="%s"/>`+"\n",
+        left, top, left, bottom, right, bottom, hexColor(snapshotAxis))
+
+    for _, l := range s.thresholds {
+        fmt.Fprintf(w, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-dasharray="6,4"/>`+"\n",
+            left, s.y(l.value), right, s.y(l.value), hexColor(snapshotThreshold))
+        fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="end" fill="%s">%s %.0f ms</text>`+"\n",
+            right, s.y(l.value)-4, hexColor(snapshotThreshold), l.label, l.value)
+    }
+
+    for i, series := range s.series {
+        stroke := hexColor(series.color)
+        // Lost probes break the line and are marked below the axis.
+        var points []string
+        line := func() {
+            if len(points) > 0 {
+                fmt.Fprintf(w, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n", strings.Join(points, " "), stroke)
+            }
+            points = points[:0]
+        }
+        for j, rtt := range series.rtt {
+            if math.IsNaN(rtt) {
+                line()
+                fmt.Fprintf(w, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`+"\n",
+                    s.x(series.at[j]), bottom+2, s.x(series.at[j]), bottom+6, stroke)
+                continue
+            }
+            points = append(points, fmt.Sprintf("%.1f,%.1f", s.x(series.at[j]), s.y(rtt)))
+        }
+        line()
+        fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="end" fill="%s">%s</text>`+"\n",
+            right-6, top+14*float64(i+1), stroke, xmlEscape(series.name))
+    }
+    fmt.Fprintln(w, `</svg>`)
+}
+
+// png renders the snapshot as an image. The standard library has no fonts,
+// so the PNG shows the lines, grid and thresholds without labels; the SVG
+// has them.
+func (s *snapshot) png() image.Image {
+    img := image.NewRGBA(image.Rect(0, 0, snapshotWidth, snapshotHeight))
+    for i := range img.Pix {
+        img.Pix[i] = 0xff
+    }
+    left, right := float64(snapshotLeft), float64(snapshotWidth-snapshotRight)
+    top, bottom := float64(snapshotTop), float64(snapshotHeight-snapshotBottom)
+    for i := 0; i <= snapshotTicks; i++ {
+        y := s.y(s.maxRTT * float64(i) / snapshotTicks)
+        drawLine(img, left, y, right, y, snapshotGrid, 0)
+    }
+    drawLine(img, left, top, left, bottom, snapshotAxis, 0)
+    drawLine(img, left, bottom, right, bottom, snapshotAxis, 0)
+    for _, l := range s.thresholds {
+        drawLine(img, left, s.y(l.value), right, s.y(l.value), snapshotThreshold, 6)
+    }
+    for _, series := range s.series {
+        for j, rtt := range series.rtt {
+            x := s.x(series.at[j])
+            switch {
+            case math.IsNaN(rtt):
+                drawLine(img, x, bottom+2, x, bottom+6, series.color, 0)
+            case j > 0 && !math.IsNaN(series.rtt[j-1]):
+                drawLine(img, s.x(series.at[j-1]), s.y(series.rtt[j-1]), x, s.y(rtt), series.color, 0)
+            default:
+                img.Set(int(x), int(s.y(rtt)), series.color)
+            }
+        }
+    }
+    return img
+}
+
+// drawLine draws a line one pixel wide, dashed with dashes of the given
+// length in pixels if dash is above 0.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.RGBA, dash int) {
+    steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0)))
+    if steps == 0 {
+        img.Set(int(x0), int(y0), c)
+        return
+    }
+    for i := 0; i <= steps; i++ {
+        if dash > 0 && (i/dash)%2 == 1 {
+            continue
+        }
+        f := float64(i) / float64(steps)
+        img.Set(int(math.Round(x0+(x1-x0)*f)), int(math.Round(y0+(y1-y0)*f)), c)
+    }
+}
+
+func hexColor(c color.RGBA) string {
+    return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func xmlEscape(s string) string {
+    return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+// snapshotOnExit writes the -snapshot-on-exit image. Where it went is
+// reported on stderr to keep the output of -classic and -nagios intact.
+func snapshotOnExit(cfg *config, targets []*target) {
+    if !cfg.snapOnExit {
+        return
+    }
+    path := snapshotPath(cfg)
+    if err := writeSnapshot(path, plotTitle(targets), cfg, targets); err != nil {
+        fmt.Fprintf(os.Stderr, "Could not write snapshot %s: %v\n", path, err)
+        return
+    }
+    fmt.Fprintf(os.Stderr, "Snapshot written to %s\n", path)
+}
@@ -0,0 +1,704 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "sort"
+    "strings"
+    "text/template"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+// Stats summarizes the samples collected for a target.
+type Stats struct {
+    Avg    float64 // ms, over valid replies
+    Max    float64
+    Min    float64
+    StdDev float64
+    Jitter float64
+    StdErr float64 // standard error of Avg
+    CI95   float64 // half width of the 95% confidence interval of Avg, 0 below 2 replies
+    P50    float64
+    P95    float64
+    P99    float64
+    Last   float64 // latest sample, the -D value if it was lost
+    Trend  int     // +1 getting slower, -1 getting faster, 0 flat or unknown
+    MA     float64 // average of the last -ma replies, NaN without any
+
+    PctTimeout float64 // replies slower than -W, in percent of all samples
+    PctLost    float64
+
+    Total         int
+    Valid         int
+    NTimeout      int // slow replies and losses
+    MaxSeqTimeout int
+    Uptime        int // probes since the current run of replies began, see uptime
+    MaxUptime     int
+    NLost         int
+    NTruncated    int
+    NCorrupted    int
+    NReordered    int // replies overtaken by the reply to a later probe
+    NWarmup       int // -warmup samples left out of all other numbers
+    Outstanding   int // probes in flight right now
+    PacingMean    time.Duration // mean deviation of the send gaps from -i
+    PacingMax     time.Duration
+    Expected      int // probes that should have been sent at -i since the start
+    Unreachable   map[string]int
+    Responders    []responder // -broadcast responders, most replies first
+    Race          *raceSummary // -happy-eyeballs comparison of the host, nil without
+    MTU           string       // -mtu-check diagnosis, empty without
+    OWD           string       // -owd one-way delay variation, empty without
+    State         hostState
+    StateSince    time.Time
+    Period        periodHint // repeating latency pattern, see latencyPeriod
+
+    LastLoss time.Time // zero if nothing was lost yet
+
+    DNSLast    float64 // ms, latest host name resolution, NaN if none succeeded
+    DNSAvg     float64
+    DNSLookups int
+    DNSFailed  int
+
+    ReplyTTL      int // of the latest reply, 0 if unknown
+    TTLChanges    int
+    LastTTLChange time.Time
+
+    TxRate  float64 // probe bytes per second sent
+    RxRate  float64 // probe bytes per second received
+    RunTime float64 // seconds
+}
+
+// computeStats summarizes the samples of t. t.mutex must be held.
+func computeStats(t *target, cfg *config, startTime time.Time) Stats {
+    st := Stats{
+        NTruncated:  t.truncated,
+        NCorrupted:  t.corrupted,
+        NReordered:  t.reordered,
+        Unreachable: t.unreachable,
+        LastLoss:    t.lastLoss,
+
+        ReplyTTL:      t.replyTTL,
+        TTLChanges:    t.ttlChanges,
+        LastTTLChange: t.lastTTLChange,
+        RunTime:       time.Since(startTime).Seconds(),
+    }
+    if t.pinger != nil {
+        st.Outstanding = t.pinger.Outstanding()
+        st.PacingMean, st.PacingMax = t.pinger.Pacing()
+    }
+    for _, r := range t.responders {
+        st.Responders = append(st.Responders, *r)
+    }
+    sort.Slice(st.Responders, func(i, j int) bool {
+        if st.Responders[i].Replies != st.Responders[j].Replies {
+            return st.Responders[i].Replies > st.Responders[j].Replies
+        }
+        return st.Responders[i].Addr < st.Responders[j].Addr
+    })
+
+    if t.race != nil {
+        race := t.race.stats()
+        st.Race = &race
+    }
+    if t.status != nil {
+        st.State, st.StateSince = t.status.current()
+    }
+    if t.mtu != nil {
+        st.MTU = t.mtu.status()
+    }
+    if t.owd != nil {
+        st.OWD = t.owd.status()
+    }
+
+    // With -low-power the sample numbers are kept up to date as samples
+    // arrive instead of being recomputed from the whole history.
+    if t.running != nil {
+        t.running.fill(&st)
+    } else {
+        scanStats(&st, t, cfg)
+    }
+
+    if len(t.times) > 0 {
+        st.Last = t.times[len(t.times)-1]
+    }
+    st.DNSLast, st.DNSAvg, st.DNSLookups, st.DNSFailed = dnsStats(t)
+    if t.running != nil {
+        t.running.fillDerived(t, cfg, &st)
+    } else {
+        st.Trend = latencyTrend(t, cfg.deadTimeout, cfg.trendWindow, time.Now())
+        st.MA = movingAverage(t, cfg.deadTimeout, cfg.warmup, cfg.movingAvg)
+        st.Period = latencyPeriod(t, cfg.deadTimeout)
+    }
+
+    // The first probe goes out right away, then one every interval
+    if cfg.interval > 0 {
+        st.Expected = int(st.RunTime/cfg.interval) + 1
+    }
+
+    st.TxRate, st.RxRate = probeRates(t, cfg, st.PctLost)
+
+    return st
+}
+
+// probeRates estimates the traffic generated by the probes themselves over
+// the samples kept after the warmup, from the first to the last one sent,
+// so trimming the history or a reset shortens the window along with the
+// count. The received rate follows from the loss percentage of the stats.
+// t.mutex must be held.
+func probeRates(t *target, cfg *config, pctLost float64) (tx, rx float64) {
+    // The warmup probes are the first ones.
+    first := 0
+    for first < len(t.pings) && t.pings[first] <= cfg.warmup {
+        first++
+    }
+    sent := len(t.times) - first
+    if sent == 0 {
+        return 0, 0
+    }
+    probeBytes := float64(pinger.ICMPHeaderSize + cfg.payloadSize)
+    span := t.stamps[len(t.stamps)-1].Sub(t.stamps[first]).Seconds()
+    switch {
+    case sent >= 2 && span > 0:
+        tx = probeBytes * float64(sent-1) / span
+    case cfg.interval > 0:
+        tx = probeBytes / cfg.interval
+    }
+    return tx, tx * (1 - pctLost/100)
+}
+
+// scanStats fills the numbers derived from the samples of t by going over
+// all of them. t.mutex must be held.
+func scanStats(st *Stats, t *target, cfg *config) {
+    times := t.times
+    if cfg.warmup > 0 {
+        times = make([]float64, 0, len(t.times))
+        for i, v := range t.times {
+            if t.pings[i] > cfg.warmup {
+                times = append(times, v)
+            }
+        }
+    }
+    st.NWarmup = len(t.times) - len(times)
+    st.Total = len(times)
+
+    validTimes := []float64{}
+    for _, t := range times {
+        if t != cfg.deadTimeout {
+            validTimes = append(validTimes, t)
+        }
+    }
+    st.Valid = len(validTimes)
+
+    if len(validTimes) > 0 {
+        sum := 0.0
+        for _, t := range validTimes {
+            sum += t
+        }
+        st.Avg = sum / float64(len(validTimes))
+
+        st.Min = validTimes[0]
+        st.Max = validTimes[0]
+        for _, t := range validTimes {
+            if t < st.Min {
+                st.Min = t
+            }
+            if t > st.Max {
+                st.Max = t
+            }
+        }
+
+        // Calculate standard deviation
+        sumSquares := 0.0
+        for _, t := range validTimes {
+            sumSquares += (t - st.Avg) * (t - st.Avg)
+        }
+        st.StdDev = math.Sqrt(sumSquares / float64(len(validTimes)))
+
+        // The confidence interval uses the sample standard deviation and
+        // Student's t, which matters while there are only a few replies.
+        if n := len(validTimes); n >= 2 {
+            st.StdErr = math.Sqrt(sumSquares/float64(n-1)) / math.Sqrt(float64(n))
+            st.CI95 = tCritical95(n-1) * st.StdErr
+        }
+
+        st.Jitter = calcJitter(times, cfg.deadTimeout, cfg.jitterGaps)
+
+        sorted := append([]float64(nil), validTimes...)
+        sort.Float64s(sorted)
+        st.P50 = percentile(sorted, 50)
+        st.P95 = percentile(sorted, 95)
+        st.P99 = percentile(sorted, 99)
+    }
+
+    // Calculate percentage slower than -slow
+    timesGreaterThanTimeout := 0
+    for _, t := range times {
+        if t > float64(cfg.slowRTT) && t != cfg.deadTimeout {
+            timesGreaterThanTimeout++
+        }
+        if t == cfg.deadTimeout {
+            st.NLost++
+        }
+    }
+    if len(times) > 0 {
+        st.PctTimeout = float64(timesGreaterThanTimeout) / float64(len(times)) * 100
+        st.PctLost = float64(st.NLost) / float64(len(times)) * 100
+    }
+
+    // Calculate maximum sequential number of times >= -slow
+    currentSequenceTimeout := 0
+    for _, t := range times {
+        if t >= float64(cfg.slowRTT) && t != cfg.deadTimeout {
+            st.NTimeout++
+            currentSequenceTimeout++
+        } else if t == cfg.deadTimeout {
+            st.NTimeout++
+            currentSequenceTimeout++
+        } else {
+            if currentSequenceTimeout > st.MaxSeqTimeout {
+                st.MaxSeqTimeout = currentSequenceTimeout
+            }
+            currentSequenceTimeout = 0
+        }
+    }
+    if currentSequenceTimeout > st.MaxSeqTimeout {
+        st.MaxSeqTimeout = currentSequenceTimeout
+    }
+
+    up := uptime{tolerance: cfg.lossTol}
+    for _, t := range times {
+        up.add(t == cfg.deadTimeout)
+    }
+    st.Uptime, st.MaxUptime = up.run, up.max
+}
+
+// uptime counts the probes of the runs of replies for the availability
+// stats. Up to tolerance lost probes in a row (-loss-tolerance) belong to
+// the run, one more ends it. A run begins with a reply and is only counted
+// as far as its last reply for the maximum.
+type uptime struct {
+    tolerance int
+    run       int
+    gap       int // lost probes in a row within the run
+    max       int
+}
+
+func (u *uptime) add(lost bool) {
+    if !lost {
+        u.run++
+        u.gap = 0
+        u.max = max(u.max, u.run)
+        return
+    }
+    if u.run == 0 {
+        return
+    }
+    u.gap++
+    u.run++
+    if u.gap > u.tolerance {
+        u.run, u.gap = 0, 0
+    }
+}
+
+// formatUptime renders a number of probes of uptime with the time they
+// cover at -i.
+func formatUptime(probes int, interval float64) string {
+    covered := time.Duration(float64(probes) * interval * float64(time.Second)).Round(time.Second)
+    return fmt.Sprintf("%d probes (%s)", probes, covered)
+}
+
+// trendThreshold is the relative change of the average between two trend
+// windows below which the latency counts as flat.
+const trendThreshold = 0.1
+
+// latencyTrend compares the average reply time of the last window to the
+// window before it, both measured back from now by the probe send times.
+// Samples are recorded in the order their results arrive, which is close to
+// but not exactly the send order, so the scan from the newest sample stops
+// one window beyond the two compared. t.mutex must be held.
+func latencyTrend(t *target, deadTimeout float64, window time.Duration, now time.Time) int {
+    if window <= 0 {
+        return 0
+    }
+    var recentSum, previousSum float64
+    var recentN, previousN int
+    for i := len(t.times) - 1; i >= 0; i-- {
+        v := t.times[i]
+        age := now.Sub(t.stamps[i])
+        if age >= 3*window {
+            break
+        }
+        if v == deadTimeout {
+            continue
+        }
+        switch {
+        case age < window:
+            recentSum += v
+            recentN++
+        case age < 2*window:
+            previousSum += v
+            previousN++
+        }
+    }
+    if recentN == 0 || previousN == 0 || previousSum == 0 {
+        return 0
+    }
+    recent := recentSum / float64(recentN)
+    previous := previousSum / float64(previousN)
+    switch change := (recent - previous) / previous; {
+    case change > trendThreshold:
+        return 1
+    case change < -trendThreshold:
+        return -1
+    }
+    return 0
+}
+
+// movingAverage returns the arithmetic mean of the last n replies after the
+// warmup, NaN if there are none. t.mutex must be held.
+func movingAverage(t *target, deadTimeout float64, warmup int, n int) float64 {
+    sum := 0.0
+    count := 0
+    for i := len(t.times) - 1; i >= 0 && count < n; i-- {
+        if t.times[i] == deadTimeout || t.pings[i] <= warmup {
+            continue
+        }
+        sum += t.times[i]
+        count++
+    }
+    if count == 0 {
+        return math.NaN()
+    }
+    return sum / float64(count)
+}
+
+// trendArrow renders a trend as a colored arrow: red up for worsening, green
+// down for improving latency.
+func trendArrow(trend int) string {
+    switch trend {
+    case 1:
+        return "[↑](fg:red)"
+    case -1:
+        return "[↓](fg:green)"
+    }
+    return "→"
+}
+
+// formatLast formats the latest sample.
+func formatLast(st Stats, cfg *config) string {
+    switch {
+    case st.Total+st.NWarmup == 0:
+        return "-"
+    case st.Last == cfg.deadTimeout:
+        return "lost"
+    }
+    return fmt.Sprintf("%.2f ms", st.Last)
+}
+
+// formatRTT formats a latency figure of the stats, "n/a" while there are
+// no replies, as 0 would read as an instant reply.
+func formatRTT(st Stats, ms float64) string {
+    if st.Valid == 0 {
+        return "n/a"
+    }
+    return fmt.Sprintf("%.2f ms", ms)
+}
+
+// formatPercentiles formats the median and the 99th percentile.
+func formatPercentiles(st Stats) string {
+    if st.Valid == 0 {
+        return "n/a"
+    }
+    return fmt.Sprintf("%.2f / %.2f ms", st.P50, st.P99)
+}
+
+// formatMA formats the moving average.
+func formatMA(ma float64) string {
+    if math.IsNaN(ma) {
+        return "-"
+    }
+    return fmt.Sprintf("%.2f ms", ma)
+}
+
+// typical returns the headline latency selected by -central.
+func (st Stats) typical(central string) float64 {
+    if central == "median" {
+        return st.P50
+    }
+    return st.Avg
+}
+
+// bloatMinSamples is the number of replies needed before the p99/p50 ratio
+// is trusted for the bufferbloat hint.
+const bloatMinSamples = 50
+
+// bufferbloat reports whether the latency spread suggests bufferbloat: the
+// link is fast when idle (p50) but queues build up under load, so the worst
+// replies (p99) take many times longer.
+func (st Stats) bufferbloat(ratio float64) bool {
+    return ratio > 0 && st.Valid >= bloatMinSamples && st.P50 > 0 && st.P99/st.P50 >= ratio
+}
+
+// updateStats returns the stats panel text for t. t.mutex must be held.
+func updateStats(t *target, cfg *config, startTime time.Time) string {
+    return formatStats(computeStats(t, cfg, startTime), cfg)
+}
+
+// formatStats renders the stats panel text, with the -stats-template if
+// one is given.
+func formatStats(st Stats, cfg *config) string {
+    if cfg.statsLayout != nil {
+        var b strings.Builder
+        if err := cfg.statsLayout.Execute(&b, st); err != nil {
+            return fmt.Sprintf("[-stats-template error: %s](fg:red)", strings.NewReplacer("[", "(", "]", ")").Replace(err.Error()))
+        }
+        return b.String()
+    }
+    lastLossText := "no loss yet"
+    if !st.LastLoss.IsZero() {
+        lastLossText = time.Since(st.LastLoss).Round(time.Second).String() + " ago"
+    }
+
+    headText := formatState(st.State, st.StateSince) + "\n"
+    if st.bufferbloat(cfg.bloatRatio) {
+        headText += fmt.Sprintf("[Bufferbloat suspected: p99 is %.1fx p50](fg:yellow)\n", st.P99/st.P50)
+    }
+    headText += formatPeriod(st.Period)
+    if len(st.Responders) > 0 {
+        headText += formatResponders(st.Responders, statsResponders)
+    }
+    if st.MTU != "" {
+        headText += fmt.Sprintf("[MTU: %s](fg:red)\n", st.MTU)
+    }
+    if st.OWD != "" {
+        headText += fmt.Sprintf("One-way: %s\n", st.OWD)
+    }
+    if st.Race != nil {
+        headText += formatRace(*st.Race)
+    }
+    headText += fmt.Sprintf("[Typical (%s): %s](mod:bold)\n", cfg.central, formatRTT(st, st.typical(cfg.central)))
+    headText += fmt.Sprintf("Current: %s %s\n", formatLast(st, cfg), trendArrow(st.Trend))
+    headText += formatCounters(st) + "\n"
+    if cfg.movingAvg > 0 {
+        headText += fmt.Sprintf("MA(%d): %s\n", cfg.movingAvg, formatMA(st.MA))
+    }
+
+    statsText := headText + fmt.Sprintf(
+        "Average: %s\nMax: %s\nMin: %s\nStd Dev: %s\nCV: %s\nStd Err: %s\nJitter: %s\nP50/P99: %s\n%% Timeout(>): %.2f%%\n%% Lost(=): %.2f%%\nTotal N: %d\nN warmup: %d\nExpected N: %d (%s)\nN timeout: %d\nMax N SEQ tim.: %d\nUptime: %s, max %s\nN lost: %d\nN truncated: %d\nN corrupted: %s\nN reordered: %d\nOutstanding: %d\nSend pacing err: %s avg, %s max\nUnreachable: %s\nLast loss: %s\nReply TTL: %s\nDNS: %s\nProbe tx: %s\nProbe rx: %s\n---settings---\n-W timeout: %d ms\n-slow: %d ms\n-D: %.0f ms\n-i interval: %.2f s\n-s size: %d B\n\nRunTime: %.2f s\n\nPress 'q' to quit\nPress 'l' to toggle scale\nPress 'L' to split the scales\nPress 'y' to lock the Y axis\nPress 'r' to reset stats\nPress 's' to hide stats\nPress 'p' to save a snapshot\nPress 'c' to capture the screen as text\nPress 'n' to add a note\nPress 'v' to toggle the loss view\nPress up/down to scroll loss events\nPress tab or 1-9 to select a host\nPress 'm' to mute its alerts\nPress 'R' to reset its stats",
+        formatRTT(st, st.Avg), formatRTT(st, st.Max), formatRTT(st, st.Min), formatRTT(st, st.StdDev), formatCV(st), formatCI(st), formatRTT(st, st.Jitter), formatPercentiles(st), st.PctTimeout, st.PctLost, st.Total, st.NWarmup, st.Expected, formatPacing(st), st.NTimeout, st.MaxSeqTimeout, formatUptime(st.Uptime, cfg.interval), formatUptime(st.MaxUptime, cfg.interval), st.NLost, st.NTruncated, formatCorrupted(st, cfg), st.NReordered, st.Outstanding, formatPacingError(st.PacingMean), formatPacingError(st.PacingMax), formatReasons(st.Unreachable), lastLossText, formatTTL(st), formatDNS(st), formatRate(st.TxRate), formatRate(st.RxRate), cfg.timeout, cfg.slowRTT, cfg.deadTimeout, cfg.interval, cfg.payloadSize, st.RunTime)
+    return statsText
+}
+
+// statsTemplateFuncs are the functions -stats-template adds to those of
+// text/template.
+var statsTemplateFuncs = template.FuncMap{
+    "ms": func(v float64) string { return fmt.Sprintf("%.2f ms", v) },
+    "ago": func(at time.Time) string {
+        if at.IsZero() {
+            return "never"
+        }
+        return time.Since(at).Round(time.Second).String() + " ago"
+    },
+}
+
+// parseStatsTemplate parses a -stats-template value, read from a file if it
+// starts with @.
+func parseStatsTemplate(value string) (*template.Template, error) {
+    if path, ok := strings.CutPrefix(value, "@"); ok {
+        text, err := os.ReadFile(path)
+        if err != nil {
+            return nil, err
+        }
+        value = string(text)
+    }
+    return template.New("stats").Funcs(statsTemplateFuncs).Parse(value)
+}
+
+// percentile returns the p-th percentile of sorted using the nearest-rank
+// method. sorted must not be empty.
+func percentile(sorted []float64, p float64) float64 {
+    rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+    if rank < 1 {
+        rank = 1
+    }
+    return sorted[rank-1]
+}
+
+// formatPacing compares the probes sent, recorded or still in flight, with
+// the number expected from the interval. A growing shortfall means the
+// sender cannot keep up with -i.
+func formatPacing(st Stats) string {
+    behind := st.Expected - st.Total - st.NWarmup - st.Outstanding
+    if behind <= 1 {
+        return "on pace"
+    }
+    return fmt.Sprintf("%d behind", behind)
+}
+
+// statsResponders is the number of -broadcast responders listed in the
+// stats panel.
+const statsResponders = 5
+
+// formatResponders lists up to limit responders with their reply count and
+// RTT, 0 lists all of them.
+func formatResponders(responders []responder, limit int) string {
+    text := fmt.Sprintf("Responders: %d\n", len(responders))
+    for i, r := range responders {
+        if limit > 0 && i == limit {
+            text += fmt.Sprintf("  ... %d more\n", len(responders)-limit)
+            break
+        }
+        text += fmt.Sprintf("  %s x%d min %.2f avg %.2f ms\n", r.Addr, r.Replies, r.MinRTT, r.avg())
+    }
+    return text
+}
+
+// tTable holds the two-sided 95% critical values of Student's t
+// distribution for 1 to 30 degrees of freedom.
+var tTable = []float64{
+    12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+    2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+    2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// tCritical95 returns the t factor of a 95% confidence interval. Beyond the
+// table the normal approximation is close enough.
+func tCritical95(df int) float64 {
+    if df <= len(tTable) {
+        return tTable[df-1]
+    }
+    return 1.96
+}
+
+// cv returns the coefficient of variation, the standard deviation in
+// percent of the average, which compares the stability of links with
+// different baselines. ok is false without a positive average.
+func (st Stats) cv() (cv float64, ok bool) {
+    if st.Valid == 0 || st.Avg <= 0 {
+        return 0, false
+    }
+    return st.StdDev / st.Avg * 100, true
+}
+
+// formatCV formats the coefficient of variation.
+func formatCV(st Stats) string {
+    cv, ok := st.cv()
+    if !ok {
+        return "-"
+    }
+    return fmt.Sprintf("%.1f%%", cv)
+}
+
+// formatCI formats the standard error and 95% confidence interval of the
+// average.
+func formatCI(st Stats) string {
+    if st.Valid == 0 {
+        return "n/a"
+    }
+    if st.CI95 == 0 && st.Valid < 2 {
+        return "n/a (need 2 replies)"
+    }
+    return fmt.Sprintf("%.2f ms, 95%% CI %.2f..%.2f ms", st.StdErr, st.Avg-st.CI95, st.Avg+st.CI95)
+}
+
+// formatCounters renders the running counters the way ping users know
+// them, e.g. "tx 120 rx 118 lost 2 (1.7%)". Probes in flight count as
+// transmitted but not yet as lost.
+func formatCounters(st Stats) string {
+    return fmt.Sprintf("tx %d rx %d lost %d (%.1f%%)", st.Total+st.Outstanding, st.Valid, st.NLost, st.PctLost)
+}
+
+// formatCorrupted shows the number of corrupted replies, in red once
+// there are any.
+func formatCorrupted(st Stats, cfg *config) string {
+    if cfg.verify == "none" {
+        return "not checked"
+    }
+    if st.NCorrupted == 0 {
+        return fmt.Sprintf("0 (%s check)", cfg.verify)
+    }
+    return fmt.Sprintf("[%d](fg:red) (%s check)", st.NCorrupted, cfg.verify)
+}
+
+// formatTTL shows the reply TTL and highlights it once it changed.
+func formatTTL(st Stats) string {
+    if st.ReplyTTL == 0 {
+        return "unknown"
+    }
+    if st.TTLChanges == 0 {
+        return fmt.Sprintf("%d", st.ReplyTTL)
+    }
+    return fmt.Sprintf("[%d, changed %dx, last %s ago](fg:yellow)", st.ReplyTTL, st.TTLChanges,
+        time.Since(st.LastTTLChange).Round(time.Second))
+}
+
+// formatPacingError formats a scheduling error in milliseconds with
+// microsecond precision.
+func formatPacingError(d time.Duration) string {
+    return fmt.Sprintf("%.3f ms", float64(d.Microseconds())/1000)
+}
+
+// formatReasons lists reason counts as "host unreachable x3, ..." ordered by
+// descending count.
+func formatReasons(counts map[string]int) string {
+    if len(counts) == 0 {
+        return "none"
+    }
+    reasons := make([]string, 0, len(counts))
+    for reason := range counts {
+        reasons = append(reasons, reason)
+    }
+    sort.Slice(reasons, func(i, j int) bool {
+        if counts[reasons[i]] != counts[reasons[j]] {
+            return counts[reasons[i]] > counts[reasons[j]]
+        }
+        return reasons[i] < reasons[j]
+    })
+    parts := make([]string, len(reasons))
+    for i, reason := range reasons {
+        parts[i] = fmt.Sprintf("%s x%d", reason, counts[reason])
+    }
+    return strings.Join(parts, ", ")
+}
+
+// formatRate formats a byte rate with a binary unit prefix.
+func formatRate(bytesPerSecond float64) string {
+    switch {
+    case bytesPerSecond >= 1024*1024:
+        return fmt.Sprintf("%.2f MiB/s", bytesPerSecond/(1024*1024))
+    case bytesPerSecond >= 1024:
+        return fmt.Sprintf("%.2f KiB/s", bytesPerSecond/1024)
+    }
+    return fmt.Sprintf("%.0f B/s", bytesPerSecond)
+}
+
+// calcJitter returns the mean absolute difference between consecutive
+// replies. With gaps "skip" lost probes are ignored, so the replies right
+// before and after a loss form a pair. With gaps "break" a loss is a
+// discontinuity: only replies to directly consecutive probes are paired,
+// and nothing is measured across the loss.
+func calcJitter(times []float64, deadTimeout float64, gaps string) float64 {
+    sumDiffs := 0.0
+    pairs := 0
+    previous := math.NaN()
+    for _, t := range times {
+        if t == deadTimeout {
+            if gaps == "break" {
+                previous = math.NaN()
+            }
+            continue
+        }
+        if !math.IsNaN(previous) {
+            sumDiffs += math.Abs(t - previous)
+            pairs++
+        }
+        previous = t
+    }
+    if pairs == 0 {
+        return 0
+    }
+    return sumDiffs / float64(pairs)
+}
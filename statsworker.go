@@ -0,0 +1,71 @@
+package main
+
+import (
+    "sync"
+    "time"
+)
+
+// statsWorker computes the stats panel texts of the graph view in its own
+// goroutine, so going over a long history does not hold up the event loop.
+// The loop asks for new texts every refresh and shows the latest ones;
+// requests made while the worker is busy are dropped.
+type statsWorker struct {
+    cfg      *config
+    targets  []*target
+    handlers []alertHandler
+    requests chan time.Time // the start time of the stats
+
+    mutex sync.Mutex
+    texts []string
+}
+
+func newStatsWorker(cfg *config, targets []*target, handlers []alertHandler) *statsWorker {
+    w := &statsWorker{
+        cfg:      cfg,
+        targets:  targets,
+        handlers: handlers,
+        requests: make(chan time.Time, 1),
+        texts:    make([]string, len(targets)),
+    }
+    for i := range w.texts {
+        w.texts[i] = "Calculating..."
+    }
+    return w
+}
+
+// run computes the texts for every request until stop is called. The
+// alerts are checked along with them.
+func (w *statsWorker) run() {
+    for startTime := range w.requests {
+        texts := make([]string, len(w.targets))
+        for i, t := range w.targets {
+            t.mutex.Lock()
+            checkAlerts(t, w.cfg, w.handlers)
+            texts[i] = t.alerts.text() + updateStats(t, w.cfg, startTime)
+            t.mutex.Unlock()
+        }
+        w.mutex.Lock()
+        w.texts = texts
+        w.mutex.Unlock()
+    }
+}
+
+// request asks for texts with the stats since startTime, unless the worker
+// is still busy with an earlier request.
+func (w *statsWorker) request(startTime time.Time) {
+    select {
+    case w.requests <- startTime:
+    default:
+    }
+}
+
+// latest returns the texts of the last completed request, one per target.
+func (w *statsWorker) latest() []string {
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    return w.texts
+}
+
+func (w *statsWorker) stop() {
+    close(w.requests)
+}
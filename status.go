@@ -0,0 +1,156 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+// hostState is the overall status of a target.
+type hostState int
+
+const (
+    stateUnknown  hostState = iota // fewer than -hysteresis samples so far
+    stateUp                        // replies within -slow
+    stateDegraded                  // slow replies, or slow and lost mixed
+    stateDown                      // probes lost
+)
+
+func (s hostState) String() string {
+    switch s {
+    case stateUp:
+        return "UP"
+    case stateDegraded:
+        return "DEGRADED"
+    case stateDown:
+        return "DOWN"
+    }
+    return "UNKNOWN"
+}
+
+// color is the termui markup color of the state.
+func (s hostState) color() string {
+    switch s {
+    case stateUp:
+        return "green"
+    case stateDegraded:
+        return "yellow"
+    case stateDown:
+        return "red"
+    }
+    return "white"
+}
+
+// stateChange is a transition of the host status, shown among the events.
+type stateChange struct {
+    At   time.Time // when the probe that completed the streak was sent
+    From hostState
+    To   hostState
+}
+
+// maxStateChanges is the number of transitions kept per target.
+const maxStateChanges = 200
+
+// hostStatus derives the status of a target from its samples with
+// hysteresis: it takes need consecutive lost probes to go DOWN, need slow
+// or lost ones to become DEGRADED, or need slow replies when DOWN, and need
+// good replies to be UP again, so a single spike does not make the status
+// flap.
+type hostStatus struct {
+    need   int
+    slow   float64 // ms
+    warmup int
+
+    mutex   sync.Mutex
+    state   hostState
+    since   time.Time
+    lost    int // consecutive lost probes
+    slowN   int // consecutive slow replies
+    bad     int // consecutive slow or lost probes
+    good    int // consecutive replies within slow
+    changes []stateChange
+}
+
+// newHostStatus registers the status tracker as an observer of t.
+func newHostStatus(t *target, cfg *config) *hostStatus {
+    s := &hostStatus{need: cfg.hysteresis, slow: float64(cfg.slowRTT), warmup: cfg.warmup}
+    t.status = s
+    t.observers = append(t.observers, s.observe)
+    return s
+}
+
+func (s *hostStatus) observe(t *target, smp sample) {
+    if smp.Seq <= s.warmup {
+        return
+    }
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    switch {
+    case smp.Lost:
+        s.lost++
+        s.slowN = 0
+        s.bad++
+        s.good = 0
+    case smp.RTT > s.slow:
+        s.lost = 0
+        s.slowN++
+        s.bad++
+        s.good = 0
+    default:
+        s.lost = 0
+        s.slowN = 0
+        s.bad = 0
+        s.good++
+    }
+
+    next := s.state
+    switch {
+    case s.lost >= s.need:
+        next = stateDown
+    case s.state == stateDown && s.slowN >= s.need, s.state != stateDown && s.bad >= s.need:
+        next = stateDegraded
+    case s.good >= s.need:
+        next = stateUp
+    }
+    if next == s.state {
+        return
+    }
+    if s.state != stateUnknown {
+        diag.Printf("%s is %s, was %s since %s\n", t.name(), next, s.state, s.since.Format("15:04:05"))
+        s.changes = append(s.changes, stateChange{At: smp.Time, From: s.state, To: next})
+        if len(s.changes) > maxStateChanges {
+            s.changes = s.changes[len(s.changes)-maxStateChanges:]
+        }
+    }
+    s.state = next
+    s.since = smp.Time
+}
+
+// current returns the state and since when it holds.
+func (s *hostStatus) current() (hostState, time.Time) {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.state, s.since
+}
+
+// history returns a copy of the transitions, oldest first.
+func (s *hostStatus) history() []stateChange {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return append([]stateChange(nil), s.changes...)
+}
+
+// reset forgets the transitions, the current state stays.
+func (s *hostStatus) reset() {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.changes = nil
+}
+
+// formatState renders the state for the top of the stats panel.
+func formatState(state hostState, since time.Time) string {
+    if state == stateUnknown {
+        return fmt.Sprintf("[State: %s](mod:bold)", state)
+    }
+    return fmt.Sprintf("[State: %s since %s](fg:%s,mod:bold)", state, since.Format("15:04:05"), state.color())
+}
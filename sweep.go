@@ -0,0 +1,196 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "os/signal"
+    "strconv"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+
+    "ping_graph_go/pinger"
+)
+
+// sweepBarWidth is the width of the longest bar of the -sweep chart.
+const sweepBarWidth = 40
+
+// parseSweep parses a -sweep range MIN:MAX[:STEP] of payload sizes in
+// bytes. Without a step the range is split into 16 steps.
+func parseSweep(value string) ([]int, error) {
+    parts := strings.Split(value, ":")
+    if len(parts) < 2 || len(parts) > 3 {
+        return nil, fmt.Errorf("%q is not MIN:MAX or MIN:MAX:STEP", value)
+    }
+    numbers := make([]int, len(parts))
+    for i, part := range parts {
+        n, err := strconv.Atoi(strings.TrimSpace(part))
+        if err != nil {
+            return nil, fmt.Errorf("%q is not a number of bytes", part)
+        }
+        numbers[i] = n
+    }
+    low, high := numbers[0], numbers[1]
+    if low < 0 || high <= low || high > pinger.MaxPayloadSize {
+        return nil, fmt.Errorf("the range must go up from 0 to at most %d bytes", pinger.MaxPayloadSize)
+    }
+    step := (high - low + 15) / 16
+    if len(numbers) == 3 {
+        step = numbers[2]
+    }
+    if step <= 0 {
+        return nil, fmt.Errorf("step %d must be positive", step)
+    }
+    var sizes []int
+    for size := low; size < high; size += step {
+        sizes = append(sizes, size)
+    }
+    return append(sizes, high), nil
+}
+
+// sweepPoint are the results for one payload size. RTTs are in ms with the
+// sub-millisecond part, serialization delay is small.
+type sweepPoint struct {
+    size int
+    sent int
+    lost int
+    min  float64
+    max  float64
+    sum  float64
+}
+
+// sweep collects the results of the payload sizes of one target.
+type sweep struct {
+    t      *target
+    mutex  sync.Mutex
+    points []sweepPoint
+    cycles int // complete passes over all sizes
+}
+
+// runSweep sends cfg.sweepCount probes of every -sweep size to every
+// target in turn, for cfg.sweepCycles passes or until interrupted with 0,
+// and prints a size against latency chart after every pass. It returns the
+// exit code.
+func runSweep(ctx context.Context, cfg *config, targets []*target, opts pinger.Options) int {
+    ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    sweeps := make([]*sweep, len(targets))
+    var wg sync.WaitGroup
+    failed := false
+    var printMutex sync.Mutex
+    for i, t := range targets {
+        s := &sweep{t: t}
+        for _, size := range cfg.sweepSizes {
+            s.points = append(s.points, sweepPoint{size: size})
+        }
+        sweeps[i] = s
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for cycle := 0; cfg.sweepCycles == 0 || cycle < cfg.sweepCycles; cycle++ {
+                if err := s.pass(ctx, cfg, opts); err != nil {
+                    printMutex.Lock()
+                    fmt.Printf("Error %v\n", err)
+                    failed = true
+                    printMutex.Unlock()
+                    return
+                }
+                if ctx.Err() != nil {
+                    return
+                }
+                printMutex.Lock()
+                fmt.Print(s.chart())
+                printMutex.Unlock()
+            }
+        }()
+    }
+    wg.Wait()
+    if failed {
+        return exitError
+    }
+    if ctx.Err() != nil {
+        // Interrupted, show what there is.
+        for _, s := range sweeps {
+            fmt.Print(s.chart())
+        }
+    }
+    return exitOK
+}
+
+// pass sends the probes of every size once.
+func (s *sweep) pass(ctx context.Context, cfg *config, opts pinger.Options) error {
+    opts.Addr = s.t.addr
+    opts.IPv6 = s.t.useIPv6
+    opts.ID = s.t.id
+    opts.Count = cfg.sweepCount
+    opts.BufSize = 0
+    check := opts.PayloadCheck
+    for i := range s.points {
+        opts.PayloadSize = s.points[i].size
+        opts.PayloadCheck = check
+        if check == pinger.CheckHash && opts.PayloadSize < pinger.HashSize {
+            opts.PayloadCheck = pinger.CheckFull
+        }
+        err := pinger.New(opts).Run(ctx, func(r pinger.Result) {
+            s.mutex.Lock()
+            defer s.mutex.Unlock()
+            p := &s.points[i]
+            p.sent++
+            if r.Status != pinger.StatusReply {
+                p.lost++
+                return
+            }
+            rtt := float64(r.RTT) / float64(time.Millisecond)
+            if p.sent-p.lost == 1 || rtt < p.min {
+                p.min = rtt
+            }
+            p.max = math.Max(p.max, rtt)
+            p.sum += rtt
+        })
+        if err != nil || ctx.Err() != nil {
+            return err
+        }
+    }
+    s.mutex.Lock()
+    s.cycles++
+    s.mutex.Unlock()
+    return nil
+}
+
+// chart renders the results as a table with a bar for the average RTT of
+// every size.
+func (s *sweep) chart() string {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    top := 0.0
+    for _, p := range s.points {
+        if replies := p.sent - p.lost; replies > 0 {
+            top = math.Max(top, p.sum/float64(replies))
+        }
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "--- %s payload sweep, passes: %d ---\n", s.t.name(), s.cycles)
+    fmt.Fprintf(&b, "%6s %5s %5s %8s %8s %8s\n", "size", "sent", "lost", "min", "avg", "max")
+    for _, p := range s.points {
+        replies := p.sent - p.lost
+        loss := 0.0
+        if p.sent > 0 {
+            loss = float64(p.lost) / float64(p.sent) * 100
+        }
+        if replies == 0 {
+            fmt.Fprintf(&b, "%6d %5d %4.0f%% %8s %8s %8s    |\n", p.size, p.sent, loss, "-", "-", "-")
+            continue
+        }
+        avg := p.sum / float64(replies)
+        bar := 1
+        if top > 0 {
+            bar = max(1, int(math.Round(avg/top*sweepBarWidth)))
+        }
+        fmt.Fprintf(&b, "%6d %5d %4.0f%% %8.3f %8.3f %8.3f ms |%s\n", p.size, p.sent, loss, p.min, avg, p.max, strings.Repeat("#", bar))
+    }
+    return b.String()
+}
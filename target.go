@@ -0,0 +1,282 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    termui "github.com/gizak/termui/v3"
+
+    "ping_graph_go/pinger"
+)
+
+// targetColors are the plot line colors assigned to targets in order,
+// replaced by applyTheme.
+var targetColors = []termui.Color{
+    termui.ColorGreen,
+    termui.ColorYellow,
+    termui.ColorCyan,
+    termui.ColorMagenta,
+    termui.ColorBlue,
+    termui.ColorRed,
+    termui.ColorWhite,
+}
+
+var targetColorNames = []string{"green", "yellow", "cyan", "magenta", "blue", "red", "white"}
+
+// target is a single address being pinged together with the samples
+// collected for it. All sample fields are guarded by mutex.
+type target struct {
+    host    string // host as given on the command line
+    addr    string // resolved IP address that is pinged
+    useIPv6 bool
+    id      int // ICMP echo identifier
+    index   int
+
+    mutex     sync.Mutex
+    times     []float64
+    pings     []int
+    stamps    []time.Time // when each probe was sent
+    pingCount int
+    lastLoss  time.Time // zero until the first lost probe
+    truncated int       // replies that did not fit the read buffer
+    corrupted int       // replies whose payload failed -payload-check
+    reordered int       // replies that arrived after the reply to a later probe
+
+    // replyTTL is the TTL of the latest reply, 0 if unknown. A change means
+    // the return path got longer or shorter.
+    replyTTL      int
+    ttlChanges    int
+    lastTTLChange time.Time
+
+    // lookups are the timed resolutions of host, none for an IP address.
+    lookups []lookup
+
+    // lossEvents are the runs of lost probes, the last one may be ongoing.
+    lossEvents []lossEvent
+
+    // unreachable counts destination unreachable errors by reason.
+    unreachable map[string]int
+
+    // responders collects the hosts answering with -broadcast, by address.
+    responders map[string]*responder
+
+    // race compares this target to the other family of the same host with
+    // -happy-eyeballs, nil otherwise.
+    race *race
+    // mtu is the -mtu-check of the target, nil without.
+    mtu *mtuCheck
+    // owd is the -owd one-way delay check of the target, nil without.
+    owd *owdCheck
+    // status is the UP/DEGRADED/DOWN state of the target.
+    status *hostStatus
+
+    // period caches the latency period search of the stats.
+    period periodHint
+
+    // running keeps the stats numbers up to date with -low-power, nil
+    // otherwise.
+    running *runningStats
+
+    // pinger probes the target, nil when replaying.
+    pinger *pinger.Pinger
+
+    // alerts is only used by the display loop, or the stats worker of the
+    // graph view.
+    alerts alertState
+
+    // observers are called after every recorded sample, outside of mutex.
+    observers []sampleObserver
+}
+
+// sample is the recorded result of one probe.
+type sample struct {
+    Seq    int
+    Time   time.Time // when the probe was sent
+    RTT    float64   // milliseconds, the -D value for lost probes
+    Lost   bool      // no valid reply was received
+    Status string    // "reply", "timeout", an unreachable reason, ...
+}
+
+// sampleObserver is notified about every sample recorded for a target.
+type sampleObserver func(t *target, s sample)
+
+func newTarget(host string, addr string, useIPv6 bool, index int) *target {
+    return &target{
+        host:    host,
+        addr:    addr,
+        useIPv6: useIPv6,
+        id:      (os.Getpid() + index) & 0xffff,
+        index:   index,
+
+        unreachable: make(map[string]int),
+        responders:  make(map[string]*responder),
+    }
+}
+
+// responder is a host that answered probes sent to a broadcast or
+// multicast address.
+type responder struct {
+    Addr    string
+    Replies int
+    MinRTT  float64 // ms
+    SumRTT  float64
+}
+
+func (r *responder) avg() float64 {
+    return r.SumRTT / float64(r.Replies)
+}
+
+// addResponse records a reply from addr with -broadcast.
+func (t *target) addResponse(addr string, rtt float64) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    r, ok := t.responders[addr]
+    if !ok {
+        r = &responder{Addr: addr, MinRTT: rtt}
+        t.responders[addr] = r
+    }
+    r.Replies++
+    r.SumRTT += rtt
+    if rtt < r.MinRTT {
+        r.MinRTT = rtt
+    }
+}
+
+// record appends a sample and notifies observers.
+func (t *target) record(s sample) {
+    t.mutex.Lock()
+    t.pingCount = s.Seq
+    t.times = append(t.times, s.RTT)
+    t.pings = append(t.pings, s.Seq)
+    t.stamps = append(t.stamps, s.Time)
+    if t.running != nil {
+        t.running.add(s.Seq, s.RTT)
+    }
+    if s.Lost {
+        t.lastLoss = s.Time
+        t.addLoss(s.Time)
+    } else {
+        t.endLoss(s.Time)
+    }
+    t.mutex.Unlock()
+
+    for _, observe := range t.observers {
+        observe(t, s)
+    }
+}
+
+// reset drops all collected samples and counters.
+func (t *target) reset() {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    t.times = nil
+    t.pings = nil
+    t.stamps = nil
+    t.pingCount = 0
+    t.lastLoss = time.Time{}
+    t.lossEvents = nil
+    t.lookups = nil
+    t.truncated = 0
+    t.corrupted = 0
+    t.reordered = 0
+    t.replyTTL = 0
+    t.ttlChanges = 0
+    t.lastTTLChange = time.Time{}
+    t.unreachable = make(map[string]int)
+    t.responders = make(map[string]*responder)
+    t.alerts = alertState{muted: t.alerts.muted}
+    t.period = periodHint{}
+    if t.running != nil {
+        t.running.reset()
+    }
+    if t.race != nil {
+        t.race.reset()
+    }
+    if t.status != nil {
+        t.status.reset()
+    }
+    if t.owd != nil {
+        t.owd.reset()
+    }
+}
+
+// updateTTL records the TTL of a reply and reports the previous one if it
+// differs.
+func (t *target) updateTTL(ttl int) (previous int, changed bool) {
+    t.mutex.Lock()
+    defer t.mutex.Unlock()
+    previous = t.replyTTL
+    t.replyTTL = ttl
+    if previous == 0 || previous == ttl {
+        return previous, false
+    }
+    t.ttlChanges++
+    t.lastTTLChange = time.Now()
+    return previous, true
+}
+
+// noReplies reports whether probes were sent but none was answered yet,
+// so there is no RTT to show. t.mutex must be held.
+func (t *target) noReplies(deadTimeout float64) bool {
+    for i := len(t.times) - 1; i >= 0; i-- {
+        if t.times[i] != deadTimeout {
+            return false
+        }
+    }
+    return len(t.times) > 0
+}
+
+// name returns a short human readable label for the target.
+func (t *target) name() string {
+    if t.host == t.addr {
+        return t.addr
+    }
+    return fmt.Sprintf("%s (%s)", t.host, t.addr)
+}
+
+func (t *target) color() termui.Color {
+    return targetColors[t.index%len(targetColors)]
+}
+
+func (t *target) colorName() string {
+    return targetColorNames[t.index%len(targetColorNames)]
+}
+
+// addrSelector describes which of the resolved addresses of a host are used.
+type addrSelector struct {
+    all   bool
+    index int
+}
+
+// parseAddrSelect parses the -addr-select flag value: "first", "all" or
+// "index:N" where N is the zero-based position in the resolver answer.
+func parseAddrSelect(value string) (addrSelector, error) {
+    switch {
+    case value == "first":
+        return addrSelector{}, nil
+    case value == "all":
+        return addrSelector{all: true}, nil
+    case strings.HasPrefix(value, "index:"):
+        n, err := strconv.Atoi(strings.TrimPrefix(value, "index:"))
+        if err != nil || n < 0 {
+            return addrSelector{}, fmt.Errorf("invalid address index in %q", value)
+        }
+        return addrSelector{index: n}, nil
+    }
+    return addrSelector{}, fmt.Errorf("unknown address selection %q (want first, all or index:N)", value)
+}
+
+// pick applies the selector to the list of candidate addresses.
+func (s addrSelector) pick(host string, addrs []string) ([]string, error) {
+    if s.all {
+        return addrs, nil
+    }
+    if s.index >= len(addrs) {
+        return nil, fmt.Errorf("Host %s has only %d matching addresses, index %d requested", host, len(addrs), s.index)
+    }
+    return addrs[s.index : s.index+1], nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    termui "github.com/gizak/termui/v3"
+)
+
+// theme is a color scheme selected with -theme.
+type theme struct {
+    lines []termui.Color // plot line colors assigned to targets in order
+    names []string       // names of the line colors for the stats titles
+    text  termui.Color   // text, borders and axes
+    extra termui.Color   // -aggregate bands and -warmup samples
+    marks []termui.Color // the -baseline, -warn and -crit lines
+}
+
+// themes are the -theme choices. dark suits the usual terminal with a dark
+// background, light avoids the yellow, cyan and white that vanish on a
+// white one, and mono leaves every color to the terminal.
+var themes = map[string]theme{
+    "dark": {
+        lines: []termui.Color{termui.ColorGreen, termui.ColorYellow, termui.ColorCyan, termui.ColorMagenta, termui.ColorBlue, termui.ColorRed, termui.ColorWhite},
+        names: []string{"green", "yellow", "cyan", "magenta", "blue", "red", "white"},
+        text:  termui.ColorWhite,
+        extra: termui.ColorWhite,
+        marks: []termui.Color{termui.ColorGreen, termui.ColorYellow, termui.ColorRed},
+    },
+    "light": {
+        lines: []termui.Color{termui.ColorBlue, termui.ColorRed, termui.ColorMagenta, termui.ColorGreen, termui.ColorBlack},
+        names: []string{"blue", "red", "magenta", "green", "black"},
+        text:  termui.ColorBlack,
+        extra: termui.ColorBlack,
+        marks: []termui.Color{termui.ColorGreen, termui.ColorMagenta, termui.ColorRed},
+    },
+    "mono": {
+        lines: []termui.Color{termui.ColorClear},
+        names: []string{"default"},
+        text:  termui.ColorClear,
+        extra: termui.ColorClear,
+        marks: []termui.Color{termui.ColorClear, termui.ColorClear, termui.ColorClear},
+    },
+}
+
+// uiTheme is the theme in use, set by applyTheme.
+var uiTheme = themes["dark"]
+
+// applyTheme selects the named theme for the target colors and the termui
+// widgets created afterwards. It reports false for an unknown name.
+func applyTheme(name string) bool {
+    th, ok := themes[name]
+    if !ok {
+        return false
+    }
+    uiTheme = th
+    targetColors = th.lines
+    targetColorNames = th.names
+
+    style := termui.NewStyle(th.text)
+    termui.Theme.Default = style
+    termui.Theme.Block.Title = style
+    termui.Theme.Block.Border = style
+    termui.Theme.Paragraph.Text = style
+    termui.Theme.List.Text = style
+    termui.Theme.Plot.Axes = th.text
+    return true
+}
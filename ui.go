@@ -0,0 +1,768 @@
+package main
+
+import (
+    "fmt"
+    "image"
+    "math"
+    "os"
+    "os/signal"
+    "regexp"
+    "strings"
+    "syscall"
+    "time"
+    "unicode/utf8"
+
+    termui "github.com/gizak/termui/v3"
+    "github.com/gizak/termui/v3/widgets"
+)
+
+// runTUI shows the latency graph and statistics of all targets until the
+// user quits or running turns false. With -low-power, wake signals a loss
+// or slow reply. Notes typed after 'n' go to notes.
+func runTUI(cfg *config, targets []*target, title string, alertHandlers []alertHandler, notes *noteLog, startTime time.Time, wake <-chan struct{}, running *bool) {
+    currentScale := "linear"
+    // yLock is the top of the Y axis in ms from -ymax or 'y', kept across
+    // scale toggles and data updates, 0 while it follows the data.
+    yLock := cfg.yMax
+    // The 'v' key replaces the latency lines with the loss percentage per
+    // -loss-window.
+    lossView := false
+
+    // Initialize termui
+    if err := termui.Init(); err != nil {
+        fmt.Printf("Failed to initialize termui: %v\n", err)
+        os.Exit(1)
+    }
+    defer termui.Close()
+
+    // Create UI elements
+    plot := newGapPlot()
+    plot.GapStyle = cfg.gapStyle
+    plot.Title = title
+    plot.Marker = widgets.MarkerBraille
+    // With -aggregate every target is drawn as a min/max band in the
+    // theme's extra color with its average line on top, in that order.
+    // With -warmup the warmup samples are drawn over the line again in that
+    // color.
+    seriesColors := func(t *target) []termui.Color {
+        if cfg.aggregate > 0 {
+            return []termui.Color{uiTheme.extra, uiTheme.extra, t.color()}
+        }
+        colors := []termui.Color{t.color()}
+        if cfg.warmup > 0 {
+            colors = append(colors, uiTheme.extra)
+        }
+        if cfg.plotDNS {
+            colors = append(colors, termui.ColorMagenta)
+        }
+        return colors
+    }
+    seriesPerTarget := len(seriesColors(targets[0]))
+    plot.Data = make([][]float64, len(targets)*seriesPerTarget)
+    plot.LineColors = nil
+    for _, t := range targets {
+        plot.LineColors = append(plot.LineColors, seriesColors(t)...)
+    }
+    // With -diff the plot has a single line, the first target's RTT minus
+    // the second's.
+    if cfg.diff {
+        plot.Data = make([][]float64, 1)
+        plot.LineColors = []termui.Color{targets[0].color()}
+    }
+    // With -split-scale, or after 'L', the same samples are drawn on a log
+    // scale next to the linear plot. The loss view hides it.
+    split := cfg.splitScale
+    logPlot := newGapPlot()
+    logPlot.GapStyle = cfg.gapStyle
+    logPlot.Title = "log10 scale"
+    logPlot.Marker = widgets.MarkerBraille
+    logPlot.Data = make([][]float64, len(plot.Data))
+    logPlot.LineColors = plot.LineColors
+    // -fill fills the area under the RTT line of every target, or its
+    // average with -aggregate, and under the loss line of the loss view.
+    if cfg.fill {
+        plot.Fill = make([]bool, len(plot.Data))
+        main := 0
+        if cfg.aggregate > 0 {
+            main = 2
+        }
+        for i := 0; i < len(plot.Data); i += seriesPerTarget {
+            plot.Fill[i+main] = true
+        }
+        logPlot.Fill = plot.Fill
+    }
+
+    // Create one stats paragraph per target. The selected one, moved with
+    // tab or the digit keys, is the target 'm' and 'R' act on.
+    statsParagraphs := make([]*widgets.Paragraph, len(targets))
+    statsColumns := make([]interface{}, len(targets))
+    selected := 0
+    titleStats := func() {
+        for i, t := range targets {
+            statsParagraphs[i].Title = statsTitle(t, len(targets) > 1 && i == selected, len(targets) > 1)
+            statsParagraphs[i].BorderStyle = termui.NewStyle(uiTheme.text)
+            if len(targets) > 1 && i == selected {
+                statsParagraphs[i].BorderStyle = termui.NewStyle(uiTheme.text, termui.ColorClear, termui.ModifierBold)
+            }
+        }
+    }
+    for i := range targets {
+        statsParagraphs[i] = widgets.NewParagraph()
+        statsParagraphs[i].Text = "Calculating..."
+        statsColumns[i] = termui.NewCol(1.0/float64(len(targets)), statsParagraphs[i])
+    }
+    titleStats()
+
+    // Loss events and status changes of all targets, scrolled with the
+    // arrow keys. The newest event stays selected until the user scrolls up.
+    events := widgets.NewList()
+    events.Title = "Events"
+    events.SelectedRowStyle = termui.NewStyle(uiTheme.text, termui.ColorClear, termui.ModifierBold)
+    followEvents := true
+
+    // Set up grid layout, the 's' key hides the stats row to give the plot
+    // the full height
+    grid := termui.NewGrid()
+    showStats := true
+    layout := func() {
+        grid.Items = nil
+        plots := termui.NewRow(0.7,
+            termui.NewCol(0.7, plot),
+            termui.NewCol(0.3, events),
+        )
+        if split && !lossView {
+            plots = termui.NewRow(0.7,
+                termui.NewCol(0.35, plot),
+                termui.NewCol(0.35, logPlot),
+                termui.NewCol(0.3, events),
+            )
+        }
+        if showStats {
+            grid.Set(plots, termui.NewRow(0.3, statsColumns...))
+        } else {
+            plots.HeightRatio = 1.0
+            grid.Set(plots)
+        }
+    }
+    layout()
+
+    // Below minTermWidth x minTermHeight the grid is not laid out at all,
+    // termui panics or draws garbage on rects that small. Instead a single
+    // paragraph says so, or shows the -oneline status with -small-terminal
+    // oneline, until the terminal is large enough again.
+    small := false
+    smallView := widgets.NewParagraph()
+    smallView.Border = false
+    resize := func(width, height int) {
+        small = width < minTermWidth || height < minTermHeight
+        if small {
+            smallView.SetRect(0, 0, max(width, 0), max(height, 0))
+            return
+        }
+        grid.SetRect(0, 0, width, height)
+    }
+    resize(termui.TerminalDimensions())
+    // render draws the given items, or the small view in their place.
+    render := func(items ...termui.Drawable) {
+        if !small {
+            termui.Render(items...)
+            return
+        }
+        if smallView.GetRect().Empty() {
+            return
+        }
+        smallView.Text = smallTerminalText(cfg, targets, startTime, smallView.GetRect())
+        termui.Render(smallView)
+    }
+
+    // Short notices shown in the plot title after key presses
+    var notice string
+    var noticeUntil time.Time
+
+    // After 'n' the keys type a note, shown in the plot title, until Enter
+    // adds it or Escape drops it.
+    typing := false
+    var noteText string
+    notePrompt := func() string {
+        return "Note: " + noteText + "_ (Enter to add, Esc to cancel)"
+    }
+
+    // The stats and alerts are computed by a worker, the event loop only
+    // shows its latest texts.
+    stats := newStatsWorker(cfg, targets, alertHandlers)
+    go stats.run()
+    defer stats.stop()
+    stats.request(startTime)
+
+    // Handle events
+    uiEvents := termui.PollEvents()
+    ticker := time.NewTicker(cfg.refresh)
+    defer ticker.Stop()
+
+    // With -low-power the display slows down to lowPowerRefresh once
+    // nothing happened for lowPowerHold, and speeds up again on an anomaly
+    // or a key press.
+    idleRefresh := lowPowerRefresh
+    if cfg.refresh > idleRefresh {
+        idleRefresh = cfg.refresh
+    }
+    fast := true
+    lastActivity := time.Now()
+    wakeUp := func() {
+        lastActivity = time.Now()
+        if !fast {
+            fast = true
+            ticker.Reset(cfg.refresh)
+        }
+    }
+
+    // Handle Ctrl+C and 'q' to quit
+    quit := func() {
+        *running = false
+        termui.Close()
+        fmt.Println("Exiting...")
+        snapshotOnExit(cfg, targets)
+        os.Exit(0)
+    }
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+    go func() {
+        <-sigs
+        quit()
+    }()
+
+    for *running {
+        select {
+        case <-wake:
+            wakeUp()
+        case e := <-uiEvents:
+            switch e.Type {
+            case termui.KeyboardEvent:
+                if cfg.lowPower {
+                    wakeUp()
+                }
+                if typing {
+                    switch e.ID {
+                    case "<Enter>":
+                        typing = false
+                        if text := strings.TrimSpace(noteText); text != "" {
+                            notes.add(note{Time: time.Now(), Text: text})
+                            notice = "note added"
+                            noticeUntil = time.Now().Add(3 * time.Second)
+                        }
+                    case "<Escape>":
+                        typing = false
+                    case "<Backspace>", "<C-<Backspace>>":
+                        if _, size := utf8.DecodeLastRuneInString(noteText); size > 0 {
+                            noteText = noteText[:len(noteText)-size]
+                        }
+                    case "<Space>":
+                        noteText += " "
+                    default:
+                        if utf8.RuneCountInString(e.ID) == 1 {
+                            noteText += e.ID
+                        }
+                    }
+                    plot.Title = title
+                    if typing {
+                        plot.Title = notePrompt()
+                    }
+                    render(plot)
+                    break
+                }
+                switch e.ID {
+                case "n":
+                    typing = true
+                    noteText = ""
+                    plot.Title = notePrompt()
+                    render(plot)
+                case "q", "<C-c>":
+                    quit()
+                case "l":
+                    if cfg.diff {
+                        notice = "no log scale for a difference"
+                        noticeUntil = time.Now().Add(3 * time.Second)
+                    } else if split && !lossView {
+                        notice = "both scales are shown, 'L' to join them"
+                        noticeUntil = time.Now().Add(3 * time.Second)
+                    } else if currentScale == "linear" {
+                        currentScale = "log"
+                    } else {
+                        currentScale = "linear"
+                    }
+                case "y":
+                    switch {
+                    case cfg.diff:
+                        notice = "no Y axis lock for a difference"
+                    case yLock > 0:
+                        yLock = 0
+                        notice = "Y axis unlocked"
+                    case lossView:
+                        notice = "the loss view always goes up to 100%"
+                    case plot.MaxVal <= 0:
+                        notice = "no data to lock the Y axis to yet"
+                    default:
+                        yLock = plot.MaxVal
+                        if currentScale == "log" && !split {
+                            yLock = math.Pow(10, plot.MaxVal)
+                        }
+                        notice = fmt.Sprintf("Y axis locked at %.2f ms, 'y' to unlock", yLock)
+                    }
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                case "L":
+                    if cfg.diff {
+                        notice = "no log scale for a difference"
+                        noticeUntil = time.Now().Add(3 * time.Second)
+                        break
+                    }
+                    split = !split
+                    layout()
+                    termui.Clear()
+                case "r":
+                    for _, t := range targets {
+                        t.reset()
+                    }
+                    startTime = time.Now()
+                    notice = "statistics reset"
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                case "R":
+                    // startTime stays, it is shared by all targets.
+                    t := targets[selected]
+                    t.reset()
+                    notice = "statistics of " + t.name() + " reset"
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                case "m":
+                    t := targets[selected]
+                    t.mutex.Lock()
+                    t.alerts.muted = !t.alerts.muted
+                    muted := t.alerts.muted
+                    t.mutex.Unlock()
+                    notice = "alerts of " + t.name() + " unmuted"
+                    if muted {
+                        notice = "alerts of " + t.name() + " muted"
+                    }
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                    titleStats()
+                case "<Tab>":
+                    selected = (selected + 1) % len(targets)
+                    titleStats()
+                    render(grid)
+                case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+                    if n := int(e.ID[0] - '1'); n < len(targets) {
+                        selected = n
+                        titleStats()
+                        render(grid)
+                    }
+                case "v":
+                    if cfg.diff {
+                        notice = "no loss view for a difference"
+                        noticeUntil = time.Now().Add(3 * time.Second)
+                    } else {
+                        lossView = !lossView
+                        layout()
+                        termui.Clear()
+                    }
+                case "p":
+                    path := snapshotPath(cfg)
+                    notice = "snapshot saved to " + path
+                    if err := writeSnapshot(path, title, cfg, targets); err != nil {
+                        notice = "snapshot failed: " + err.Error()
+                    }
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                case "c":
+                    path, err := captureScreen(title, cfg, targets, stats.latest())
+                    notice = "screen captured to " + path
+                    if err != nil {
+                        notice = "capture failed: " + err.Error()
+                    }
+                    noticeUntil = time.Now().Add(3 * time.Second)
+                case "s":
+                    showStats = !showStats
+                    layout()
+                    termui.Clear()
+                    render(grid)
+                case "<Up>":
+                    followEvents = false
+                    events.ScrollUp()
+                    render(events)
+                case "<Down>":
+                    events.ScrollDown()
+                    followEvents = events.SelectedRow >= len(events.Rows)-1
+                    render(events)
+                }
+            case termui.ResizeEvent:
+                payload := e.Payload.(termui.Resize)
+                resize(payload.Width, payload.Height)
+                termui.Clear()
+            }
+        case <-ticker.C:
+            if cfg.lowPower && fast && time.Since(lastActivity) > lowPowerHold {
+                fast = false
+                ticker.Reset(idleRefresh)
+            }
+
+            // Update plot and stats
+            plot.Title = title
+            if lossView {
+                plot.Title += fmt.Sprintf(" (loss %% per %v)", cfg.lossWindow)
+            }
+            if time.Now().Before(noticeUntil) {
+                plot.Title += " | " + notice
+            }
+            if typing {
+                plot.Title = notePrompt()
+            }
+            plot.MaxVal = 0
+            logPlot.MaxVal = 0
+            plot.Bands, logPlot.Bands = nil, nil
+            points := cfg.plotPoints
+            if points <= 0 {
+                points = plotWidth(&plot.Plot)
+            }
+            stats.request(startTime)
+            statsTexts := stats.latest()
+            var silent []string
+            for i, t := range targets {
+                // Only the tail that fits the plot is copied, the full
+                // history stays with the target for the stats.
+                var series [][]float64
+                var band *plotBand
+                t.mutex.Lock()
+                if lossView {
+                    buckets := aggregate(t.times, t.stamps, cfg.deadTimeout, cfg.lossWindow)
+                    if len(buckets) > points {
+                        buckets = buckets[len(buckets)-points:]
+                    }
+                    // The line goes in the target's color, after the
+                    // -aggregate band.
+                    main := 0
+                    if cfg.aggregate > 0 {
+                        main = 2
+                    }
+                    series = lossSeries(buckets, main, seriesPerTarget)
+                } else if cfg.aggregate > 0 {
+                    buckets := aggregate(t.times, t.stamps, cfg.deadTimeout, cfg.aggregate)
+                    if len(buckets) > points {
+                        buckets = buckets[len(buckets)-points:]
+                    }
+                    series = bucketSeries(buckets)
+                } else {
+                    tail := t.times
+                    if len(tail) > points {
+                        tail = tail[len(tail)-points:]
+                    }
+                    plotData := make([]float64, len(tail))
+                    copy(plotData, tail)
+                    series = [][]float64{plotData}
+                    if cfg.warmup > 0 {
+                        seqs := t.pings[len(t.pings)-len(tail):]
+                        warmupData := make([]float64, len(tail))
+                        for j, seq := range seqs {
+                            warmupData[j] = math.NaN()
+                            if seq <= cfg.warmup {
+                                warmupData[j] = tail[j]
+                            }
+                        }
+                        series = append(series, warmupData)
+                    }
+                    if cfg.plotDNS {
+                        series = append(series, dnsSeries(t, t.stamps[len(t.stamps)-len(tail):]))
+                    }
+                    if cfg.band > 0 {
+                        low, high := bandSeries(t.times, len(t.times)-len(tail), cfg.deadTimeout, cfg.band)
+                        band = &plotBand{Low: low, High: high, Color: gapDimColor}
+                    }
+                }
+                noReplies := t.noReplies(cfg.deadTimeout)
+                t.mutex.Unlock()
+
+                // Without a single reply the -D line would pass for an RTT,
+                // the title says there is none instead.
+                if noReplies && !lossView {
+                    silent = append(silent, t.name())
+                    for _, plotData := range series {
+                        for j := range plotData {
+                            plotData[j] = math.NaN()
+                        }
+                    }
+                }
+
+                // With -valid-only lost probes become gaps in the lines, so
+                // the Y axis scales to the replies instead of the -D value.
+                if cfg.validOnly && !lossView {
+                    for _, plotData := range series {
+                        for j, v := range plotData {
+                            if v == cfg.deadTimeout {
+                                plotData[j] = math.NaN()
+                            }
+                        }
+                    }
+                }
+
+                for k, plotData := range series {
+                    if len(plotData) > 0 && !cfg.diff {
+                        if split && !lossView {
+                            logData := logSeries(plotData)
+                            logPlot.Data[i*seriesPerTarget+k] = logData
+                            logPlot.MaxVal = math.Max(logPlot.MaxVal, maxFloat64(nanFree([][]float64{logData})))
+                        } else if currentScale == "log" && !lossView {
+                            plotData = logSeries(plotData)
+                        }
+                        plot.Data[i*seriesPerTarget+k] = plotData
+                        // plot.MinVal is not available; termui handles MinVal internally
+                        plot.MaxVal = math.Max(plot.MaxVal, maxFloat64(nanFree([][]float64{plotData})))
+                    }
+                }
+
+                // The -band goes behind the lines of all targets, on the
+                // same scale.
+                if band != nil && !noReplies {
+                    if split {
+                        logBand := plotBand{Low: logSeries(band.Low), High: logSeries(band.High), Color: band.Color}
+                        logPlot.Bands = append(logPlot.Bands, logBand)
+                        logPlot.MaxVal = math.Max(logPlot.MaxVal, maxFloat64(nanFree([][]float64{logBand.High})))
+                    } else if currentScale == "log" {
+                        band.Low, band.High = logSeries(band.Low), logSeries(band.High)
+                    }
+                    plot.Bands = append(plot.Bands, *band)
+                    plot.MaxVal = math.Max(plot.MaxVal, maxFloat64(nanFree([][]float64{band.High})))
+                }
+
+                // The stats are from the worker's last round
+                statsParagraphs[i].Text = reflowStats(statsTexts[i], statsParagraphs[i].Inner.Dx(), statsParagraphs[i].Inner.Dy())
+                if cfg.audio {
+                    t.mutex.Lock()
+                    statsParagraphs[i].TitleStyle.Fg = lastResultColor(t.times, cfg.slowRTT, cfg.deadTimeout)
+                    t.mutex.Unlock()
+                }
+            }
+
+            plot.RefLines, logPlot.RefLines = nil, nil
+            if !lossView && !cfg.diff {
+                plot.RefLines = refLines(cfg, currentScale == "log" && !split)
+                plot.MaxVal = fitRefLines(plot.MaxVal, plot.RefLines)
+                logPlot.RefLines = refLines(cfg, true)
+                logPlot.MaxVal = fitRefLines(logPlot.MaxVal, logPlot.RefLines)
+            }
+            if yLock > 0 && !lossView && !cfg.diff {
+                plot.MaxVal = lockedMax(yLock, currentScale == "log" && !split)
+                logPlot.MaxVal = lockedMax(yLock, true)
+            }
+            if lossView {
+                plot.MaxVal = 100
+            }
+            if len(silent) > 0 && !cfg.diff && !typing {
+                if len(targets) == 1 {
+                    plot.Title += " | 100% loss, no RTT data"
+                } else {
+                    plot.Title += " | " + strings.Join(silent, ", ") + ": 100% loss, no RTT data"
+                }
+            }
+            if cfg.diff {
+                diff := diffSeries(targets[0], targets[1], points, cfg.deadTimeout, time.Duration(cfg.interval*float64(time.Second)/2))
+                plot.Data[0] = diff
+                plot.MaxVal = maxFloat64(nanFree([][]float64{diff}))
+                plot.MinVal = minFloat64(nanFree([][]float64{diff}))
+                plot.Title = diffTitle(targets[0], targets[1], diff)
+                if time.Now().Before(noticeUntil) {
+                    plot.Title += " | " + notice
+                }
+                if typing {
+                    plot.Title = notePrompt()
+                }
+            }
+
+            events.Rows = lossEventRows(targets, notes.all())
+            switch {
+            case len(events.Rows) == 0:
+                events.SelectedRow = 0
+            case followEvents || events.SelectedRow >= len(events.Rows):
+                events.ScrollBottom()
+            }
+
+            // Render from the first sample on, a single one shows as a point
+            render(grid)
+        }
+    }
+}
+
+// minTermWidth and minTermHeight are the smallest terminal the graph view
+// is drawn in.
+const (
+    minTermWidth  = 40
+    minTermHeight = 12
+)
+
+// smallTerminalText is shown instead of the graph while the terminal is
+// below the minimum size: a request to enlarge it, or the -oneline status
+// of the targets with -small-terminal oneline.
+func smallTerminalText(cfg *config, targets []*target, startTime time.Time, rect image.Rectangle) string {
+    if cfg.smallTerm == "oneline" {
+        parts := make([]string, len(targets))
+        for i, t := range targets {
+            t.mutex.Lock()
+            parts[i] = onelineStatus(t, computeStats(t, cfg, startTime), cfg)
+            t.mutex.Unlock()
+        }
+        return strings.Join(parts, " | ")
+    }
+    return fmt.Sprintf("Terminal too small (%dx%d), the graph needs at least %dx%d. Waiting for a resize, 'q' quits.",
+        rect.Dx(), rect.Dy(), minTermWidth, minTermHeight)
+}
+
+// refLines returns the -baseline, -warn and -crit lines of the graph that
+// are set, on the log scale if log.
+func refLines(cfg *config, log bool) []refLine {
+    var lines []refLine
+    for i, ref := range []struct {
+        name  string
+        value float64
+    }{{"baseline", cfg.baseline}, {"warn", cfg.warnLimit.rtt}, {"crit", cfg.critLimit.rtt}} {
+        if ref.value <= 0 {
+            continue
+        }
+        line := refLine{Value: ref.value, Label: fmt.Sprintf("%s %g ms", ref.name, ref.value), Color: uiTheme.marks[i]}
+        if log {
+            line.Value = math.Log10(ref.value)
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// fitRefLines raises the top of the Y axis to show the reference lines
+// not far above the data, up to half as high again, so a distant -crit
+// does not flatten the lines.
+func fitRefLines(maxVal float64, lines []refLine) float64 {
+    top := maxVal
+    for _, line := range lines {
+        if line.Value <= maxVal*1.5 {
+            top = math.Max(top, line.Value*1.05)
+        }
+    }
+    return top
+}
+
+// lockedMax returns the top of the Y axis for the locked value in ms, on
+// the log scale if log. The log scale starts at 1 ms, below that the
+// axis follows the data again.
+func lockedMax(yLock float64, log bool) float64 {
+    if !log {
+        return yLock
+    }
+    if yLock <= 1 {
+        return 0
+    }
+    return math.Log10(yLock)
+}
+
+// logSeries returns the log10 of the RTTs for the log scale, NaN gaps stay
+// and RTTs of 0 go on the 1 ms line.
+func logSeries(data []float64) []float64 {
+    transformed := make([]float64, len(data))
+    for i, v := range data {
+        if v > 0 || math.IsNaN(v) {
+            transformed[i] = math.Log10(v)
+        } else {
+            transformed[i] = 0
+        }
+    }
+    return transformed
+}
+
+// statsTitle returns the title of the stats paragraph of t. In multi-host
+// mode it names the target and marks the selected one.
+func statsTitle(t *target, selected, multi bool) string {
+    title := "Statistics"
+    if multi {
+        title = fmt.Sprintf("Statistics: %s [%s]", t.name(), t.colorName())
+    }
+    if selected {
+        title = "> " + title
+    }
+    t.mutex.Lock()
+    if t.alerts.muted {
+        title += " (muted)"
+    }
+    t.mutex.Unlock()
+    return title
+}
+
+// plotWidth returns how many samples fit the plot drawing area: the line
+// chart advances one cell per sample, and the Y axis labels take 5 columns.
+func plotWidth(plot *widgets.Plot) int {
+    width := plot.Inner.Dx() - 5
+    if width < 2 {
+        width = 2
+    }
+    return width
+}
+
+// statsColumnGap is the space between two columns of the stats panel.
+const statsColumnGap = 3
+
+// styleMarkup matches the termui "[text](style)" markup.
+var styleMarkup = regexp.MustCompile(`\[([^\]]*)\]\([a-z:, ]+\)`)
+
+// visibleWidth returns the width of a stats line on screen, without markup.
+func visibleWidth(line string) int {
+    return utf8.RuneCountInString(styleMarkup.ReplaceAllString(line, "$1"))
+}
+
+// reflowStats lays the lines of the stats text out in as many columns,
+// filled top to bottom, as it takes to fit the panel height, or as fit its
+// width. Before the panel was drawn once its size is unknown and the text
+// stays a single column.
+func reflowStats(text string, width, height int) string {
+    lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+    if height <= 0 || len(lines) <= height {
+        return text
+    }
+    cellWidth := 0
+    for _, line := range lines {
+        if w := visibleWidth(line); w > cellWidth {
+            cellWidth = w
+        }
+    }
+    maxColumns := (width + statsColumnGap) / (cellWidth + statsColumnGap)
+    columns := (len(lines) + height - 1) / height
+    if columns > maxColumns {
+        columns = maxColumns
+    }
+    if columns < 2 {
+        return text
+    }
+
+    rows := (len(lines) + columns - 1) / columns
+    var b strings.Builder
+    for row := 0; row < rows; row++ {
+        for column := 0; column < columns; column++ {
+            i := column*rows + row
+            if i >= len(lines) {
+                break
+            }
+            b.WriteString(lines[i])
+            if column < columns-1 && i+rows < len(lines) {
+                b.WriteString(strings.Repeat(" ", cellWidth-visibleWidth(lines[i])+statsColumnGap))
+            }
+        }
+        b.WriteString("\n")
+    }
+    return b.String()
+}
+
+// lastResultColor returns the color matching the most recent sample: green
+// for a reply within -slow, yellow for a slower reply and red for a loss.
+func lastResultColor(times []float64, slow int, deadTimeout float64) termui.Color {
+    if len(times) == 0 {
+        return termui.ColorClear
+    }
+    last := times[len(times)-1]
+    switch {
+    case last == deadTimeout:
+        return termui.ColorRed
+    case last > float64(slow):
+        return termui.ColorYellow
+    }
+    return termui.ColorGreen
+}
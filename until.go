@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "os/signal"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// untilWaiter watches the samples of all targets for -until-up or
+// -until-down and signals done once every target reached the state.
+type untilWaiter struct {
+    up   bool // -until-up, otherwise -until-down
+    done chan struct{}
+
+    mutex   sync.Mutex
+    reached map[*target]sample // the sample that reached the state
+    total   int
+}
+
+// newUntilWaiter registers the waiter as an observer of the targets.
+func newUntilWaiter(up bool, targets []*target) *untilWaiter {
+    w := &untilWaiter{
+        up:      up,
+        done:    make(chan struct{}),
+        reached: make(map[*target]sample),
+        total:   len(targets),
+    }
+    for _, t := range targets {
+        t.observers = append(t.observers, w.observe)
+    }
+    return w
+}
+
+func (w *untilWaiter) observe(t *target, s sample) {
+    if s.Lost == w.up {
+        return
+    }
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    if _, ok := w.reached[t]; ok {
+        return
+    }
+    w.reached[t] = s
+    if len(w.reached) == w.total {
+        close(w.done)
+    }
+}
+
+// runUntil waits until every target is up (a reply arrived) or down (a
+// probe went unanswered), the -timeout-total passed or an interrupt, and
+// returns the exit code.
+func runUntil(cfg *config, w *untilWaiter, targets []*target, startTime time.Time, wg *sync.WaitGroup, running *bool) int {
+    stopped := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(stopped)
+    }()
+    var timeout <-chan time.Time
+    if cfg.untilLimit > 0 {
+        timeout = time.After(cfg.untilLimit)
+    }
+    sigs := make(chan os.Signal, 1)
+    signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+    state := "down"
+    if w.up {
+        state = "up"
+    }
+    select {
+    case <-w.done:
+    case <-stopped:
+        if !*running {
+            return exitError
+        }
+    case <-timeout:
+    case <-sigs:
+    }
+
+    w.mutex.Lock()
+    defer w.mutex.Unlock()
+    code := exitOK
+    for _, t := range targets {
+        s, ok := w.reached[t]
+        switch {
+        case !ok:
+            fmt.Printf("%s is not %s after %.1f s\n", t.name(), state, time.Since(startTime).Seconds())
+            code = exitUnhealthy
+        case w.up:
+            fmt.Printf("%s is up: reply to probe %d in %.2f ms after %.1f s\n", t.name(), s.Seq, s.RTT, s.Time.Sub(startTime).Seconds())
+        default:
+            fmt.Printf("%s is down: probe %d got no reply (%s) after %.1f s\n", t.name(), s.Seq, s.Status, s.Time.Sub(startTime).Seconds())
+        }
+    }
+    return code
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+    "context"
+    "time"
+)
+
+// volumeCheckInterval is how often -max-bytes adds up the traffic.
+const volumeCheckInterval = 100 * time.Millisecond
+
+// traffic returns the bytes sent and received by the probes of t so far.
+func (t *target) traffic() (sent, received int64) {
+    t.mutex.Lock()
+    p := t.pinger
+    t.mutex.Unlock()
+    if p == nil {
+        return 0, 0
+    }
+    return p.Traffic()
+}
+
+// limitVolume stops the run with cancel once the probes of all targets
+// together sent and received max bytes, for -max-bytes.
+func limitVolume(ctx context.Context, cancel func(), targets []*target, max int64) {
+    ticker := time.NewTicker(volumeCheckInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        var total int64
+        for _, t := range targets {
+            sent, received := t.traffic()
+            total += sent + received
+        }
+        if total >= max {
+            diag.Printf("Data volume limit (-max-bytes) of %d bytes reached with %d bytes, stopping\n", max, total)
+            cancel()
+            return
+        }
+    }
+}
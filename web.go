@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    _ "embed"
+    "encoding/json"
+    "fmt"
+    "net"
+    "net/http"
+    "time"
+)
+
+//go:embed web/index.html
+var webIndex []byte
+
+// webPoints is the number of samples per target sent to the browser when
+// -plot-points does not set it.
+const webPoints = 300
+
+// webSeries is the tail of the samples of one target for the -web chart.
+// Lost probes are null.
+type webSeries struct {
+    Color string     `json:"color"`
+    RTT   []*float64 `json:"rtt_ms"`
+}
+
+// webSnapshot is one update pushed to the browsers, with the stats of the
+// -fifo lines.
+type webSnapshot struct {
+    Title  string       `json:"title"`
+    Stats  fifoSnapshot `json:"stats"`
+    Series []webSeries  `json:"series"`
+}
+
+// runWeb serves the -web page on listener until ctx is done: the page at /
+// and an event stream at /events that sends a webSnapshot every
+// cfg.refresh.
+func runWeb(ctx context.Context, listener net.Listener, cfg *config, targets []*target, startTime time.Time) {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/" {
+            http.NotFound(w, r)
+            return
+        }
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Write(webIndex)
+    })
+    mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+        flusher, ok := w.(http.Flusher)
+        if !ok {
+            http.Error(w, "streaming not supported", http.StatusInternalServerError)
+            return
+        }
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Header().Set("Cache-Control", "no-cache")
+        ticker := time.NewTicker(cfg.refresh)
+        defer ticker.Stop()
+        for {
+            data, err := json.Marshal(takeWebSnapshot(cfg, targets, startTime))
+            if err != nil {
+                diag.Printf("Error encoding -web update: %v\n", err)
+                return
+            }
+            if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+                return
+            }
+            flusher.Flush()
+            select {
+            case <-r.Context().Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    })
+
+    server := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+    go func() {
+        <-ctx.Done()
+        server.Close()
+    }()
+    if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+        diag.Printf("Error serving -web: %v\n", err)
+    }
+}
+
+func takeWebSnapshot(cfg *config, targets []*target, startTime time.Time) webSnapshot {
+    snap := webSnapshot{
+        Title: plotTitle(targets),
+        Stats: takeFIFOSnapshot(cfg, targets, startTime),
+    }
+    points := cfg.plotPoints
+    if points <= 0 {
+        points = webPoints
+    }
+    for _, t := range targets {
+        t.mutex.Lock()
+        tail := t.times
+        if len(tail) > points {
+            tail = tail[len(tail)-points:]
+        }
+        series := webSeries{Color: t.colorName(), RTT: make([]*float64, len(tail))}
+        for i, v := range tail {
+            if v != cfg.deadTimeout {
+                series.RTT[i] = &v
+            }
+        }
+        t.mutex.Unlock()
+        snap.Series = append(snap.Series, series)
+    }
+    return snap
+}
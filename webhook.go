@@ -0,0 +1,90 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+)
+
+const (
+    // webhookAttempts is how often a delivery is tried before the alert is
+    // dropped.
+    webhookAttempts = 4
+    // webhookBackoff is the wait before the first retry, doubled for every
+    // further one.
+    webhookBackoff = time.Second
+)
+
+// webhookNotifier POSTs alerts as JSON to a URL, e.g. a Slack or PagerDuty
+// incoming webhook. Alerts are queued by handle and delivered by run, so a
+// slow endpoint never holds up pinging or the UI; when the queue is full
+// new alerts are dropped.
+type webhookNotifier struct {
+    endpoint string
+    alerts   chan alert
+    client   *http.Client
+}
+
+func newWebhookNotifier(rawURL string) (*webhookNotifier, error) {
+    endpoint, err := url.Parse(rawURL)
+    if err != nil {
+        return nil, err
+    }
+    if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+        return nil, fmt.Errorf("unsupported webhook URL scheme %q (want http or https)", endpoint.Scheme)
+    }
+    if endpoint.Host == "" {
+        return nil, fmt.Errorf("webhook URL %q has no host", rawURL)
+    }
+    return &webhookNotifier{
+        endpoint: endpoint.String(),
+        alerts:   make(chan alert, 64),
+        client:   &http.Client{Timeout: 10 * time.Second},
+    }, nil
+}
+
+func (w *webhookNotifier) handle(a alert) {
+    select {
+    case w.alerts <- a:
+    default:
+    }
+}
+
+// run delivers queued alerts one at a time, retrying failed deliveries with
+// exponential backoff.
+func (w *webhookNotifier) run() {
+    for a := range w.alerts {
+        backoff := webhookBackoff
+        for attempt := 1; ; attempt++ {
+            err := w.send(a)
+            if err == nil {
+                break
+            }
+            if attempt == webhookAttempts {
+                diag.Printf("Error posting alert to webhook, giving up: %v\n", err)
+                break
+            }
+            time.Sleep(backoff)
+            backoff *= 2
+        }
+    }
+}
+
+func (w *webhookNotifier) send(a alert) error {
+    body, err := json.Marshal(a)
+    if err != nil {
+        return err
+    }
+    resp, err := w.client.Post(w.endpoint, "application/json", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        return fmt.Errorf("webhook returned %s", resp.Status)
+    }
+    return nil
+}